@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -14,6 +15,8 @@ import (
 type Client struct {
 	apiKey string
 	client *http.Client
+	retry  retryPolicy
+	limit  *rateLimiter
 }
 
 type Error struct {
@@ -28,6 +31,23 @@ type DataPayload struct {
 	Data models.DatasetRows `json:"data"`
 }
 
+// remoteDataset is a dataset as it exists in Geckoboard
+type remoteDataset struct {
+	ID       string                  `json:"id"`
+	Fields   map[string]models.Field `json:"fields"`
+	UniqueBy []string                `json:"unique_by"`
+}
+
+// responseError is returned for a 4xx response from Geckoboard
+type responseError struct {
+	statusCode int
+	message    string
+}
+
+func (e *responseError) Error() string {
+	return fmt.Sprintf(errInvalidPayload, e.message)
+}
+
 var (
 	gbHost    = "https://api.geckoboard.com"
 	userAgent = fmt.Sprintf("SQL-Dataset/%s-%s", version, gitSHA)
@@ -38,10 +58,6 @@ var (
 	errUnexpectedResponse = errors.New("Sorry, there seems to be a problem with " +
 		"Geckoboard's servers. Please try again, or check" +
 		"https://geckoboard.statuspage.io")
-
-	errMoreRowsToSend = "You're trying to send %d records, but 'replace' " +
-		"mode only supports sending %d. To send more, please change " +
-		"your dataset's update_type to 'append'\n"
 )
 
 func NewClient(apiKey string) *Client {
@@ -51,84 +67,106 @@ func NewClient(apiKey string) *Client {
 	}
 }
 
-func (c *Client) FindOrCreateDataset(ds *models.Dataset) error {
+func (c *Client) FindOrCreateDataset(ctx context.Context, ds *models.Dataset) error {
 	if err := ds.BuildSchemaFields(); err != nil {
 		return err
 	}
 
-	resp, err := c.makeRequest(http.MethodPut, fmt.Sprintf("/datasets/%s", ds.Name), ds)
+	err := c.doRequest(ctx, http.MethodPut, fmt.Sprintf("/datasets/%s", ds.Name), ds, nil)
 
-	if err != nil {
+	// A conflict means the dataset exists with a different schema
+	var re *responseError
+	if !errors.As(err, &re) || re.statusCode != http.StatusConflict {
+		return err
+	}
+
+	remote, getErr := c.getDataset(ctx, ds.Name)
+	if getErr != nil {
 		return err
 	}
 
-	defer resp.Body.Close()
-	return handleResponse(resp)
+	if diff := schemaDiff(ds, remote); len(diff) > 0 {
+		return &schemaConflictError{name: ds.Name, diff: diff}
+	}
+
+	return err
 }
 
-func (c *Client) DeleteDataset(name string) (err error) {
-	resp, err := c.makeRequest(http.MethodDelete, fmt.Sprintf("/datasets/%s", name), nil)
-	if err != nil {
-		return err
+func (c *Client) getDataset(ctx context.Context, name string) (*remoteDataset, error) {
+	var ds remoteDataset
+
+	if err := c.doRequest(ctx, http.MethodGet, fmt.Sprintf("/datasets/%s", name), nil, &ds); err != nil {
+		return nil, err
 	}
 
-	defer resp.Body.Close()
-	return handleResponse(resp)
+	return &ds, nil
 }
 
-func (c *Client) sendData(ds *models.Dataset, data models.DatasetRows) (err error) {
-	method := http.MethodPost
+// ListDatasets returns every dataset in the account
+func (c *Client) ListDatasets(ctx context.Context) ([]remoteDataset, error) {
+	var resp struct {
+		Data []remoteDataset `json:"data"`
+	}
 
-	if ds.UpdateType == models.Replace {
-		method = http.MethodPut
+	if err := c.doRequest(ctx, http.MethodGet, "/datasets", nil, &resp); err != nil {
+		return nil, err
 	}
 
-	resp, err := c.makeRequest(method, fmt.Sprintf("/datasets/%s/data", ds.Name), DataPayload{data})
-	if err != nil {
-		return err
+	return resp.Data, nil
+}
+
+func (c *Client) DeleteDataset(ctx context.Context, name string) (err error) {
+	return c.doRequest(ctx, http.MethodDelete, fmt.Sprintf("/datasets/%s", name), nil, nil)
+}
+
+// DeleteRecords deletes the records matching the unique_by values
+// of each row from the dataset, in batches of maxRows
+func (c *Client) DeleteRecords(ctx context.Context, ds *models.Dataset, data models.DatasetRows) error {
+	for i := 0; i < len(data); i += maxRows {
+		end := i + maxRows
+		if end > len(data) {
+			end = len(data)
+		}
+
+		if err := c.sendData(ctx, ds, http.MethodDelete, data[i:end]); err != nil {
+			return err
+		}
 	}
 
-	defer resp.Body.Close()
-	return handleResponse(resp)
-}
-
-// SendAllData determines how to send the data to Geckoboard and returns an error
-// if there is too much data for replace dataset and batches requests for append
-func (c *Client) SendAllData(ds *models.Dataset, data models.DatasetRows) (err error) {
-	switch ds.UpdateType {
-	case models.Replace:
-		if len(data) > maxRows {
-			err = c.sendData(ds, data[0:maxRows])
-			if err == nil {
-				err = fmt.Errorf(errMoreRowsToSend, len(data), maxRows)
-			}
-		} else {
-			err = c.sendData(ds, data)
+	return nil
+}
+
+func (c *Client) sendData(ctx context.Context, ds *models.Dataset, method string, data models.DatasetRows) (err error) {
+	return c.doRequest(ctx, method, fmt.Sprintf("/datasets/%s/data", ds.Name), DataPayload{data}, nil)
+}
+
+// SendAllData sends the data to Geckoboard in batches of maxRows. For a replace
+// dataset the first batch replaces the existing data and the rest are appended
+// to it, so datasets larger than a single batch are still fully replaced.
+func (c *Client) SendAllData(ctx context.Context, ds *models.Dataset, data models.DatasetRows) error {
+	replace := ds.UpdateType == models.Replace
+
+	// A replace is always sent, even without data, to clear the dataset
+	for i := 0; i < len(data) || (replace && i == 0); i += maxRows {
+		end := i + maxRows
+		if end > len(data) {
+			end = len(data)
 		}
-	case models.Append:
-		grps := len(data) / maxRows
-
-		for i := 0; i <= grps; i++ {
-			batch := maxRows * i
-
-			if i == grps {
-				if batch+1 <= len(data) {
-					err = c.sendData(ds, data[batch:])
-				}
-			} else {
-				err = c.sendData(ds, data[batch:maxRows*(i+1)])
-			}
-
-			if err != nil {
-				return err
-			}
+
+		method := http.MethodPost
+		if replace && i == 0 {
+			method = http.MethodPut
+		}
+
+		if err := c.sendData(ctx, ds, method, data[i:end]); err != nil {
+			return err
 		}
 	}
 
-	return err
+	return nil
 }
 
-func (c *Client) makeRequest(method, path string, body interface{}) (resp *http.Response, err error) {
+func (c *Client) makeRequest(ctx context.Context, method, path string, body interface{}) (resp *http.Response, err error) {
 	var buf bytes.Buffer
 
 	if body != nil {
@@ -138,7 +176,7 @@ func (c *Client) makeRequest(method, path string, body interface{}) (resp *http.
 	}
 
 	url := gbHost + path
-	req, err := http.NewRequest(method, url, &buf)
+	req, err := http.NewRequestWithContext(ctx, method, url, &buf)
 	if err != nil {
 		return nil, err
 	}
@@ -149,16 +187,21 @@ func (c *Client) makeRequest(method, path string, body interface{}) (resp *http.
 	return c.client.Do(req)
 }
 
-func handleResponse(resp *http.Response) error {
+// handleResponse decodes a successful response into out when given
+func handleResponse(resp *http.Response, out interface{}) error {
 	res := resp.StatusCode
 
 	switch {
 	case res >= 200 && res < 300:
+		if out != nil {
+			return json.NewDecoder(resp.Body).Decode(out)
+		}
+
 		return nil
 	case res >= 400 && res < 500:
 		var err Error
 		json.NewDecoder(resp.Body).Decode(&err)
-		return fmt.Errorf(errInvalidPayload, err.Detail.Message)
+		return &responseError{statusCode: res, message: err.Detail.Message}
 	default:
 		return errUnexpectedResponse
 	}
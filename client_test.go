@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -213,7 +214,7 @@ func TestFindOrCreateDataset(t *testing.T) {
 		gbHost = server.URL
 
 		c := NewClient(apiKey)
-		err := c.FindOrCreateDataset(&tc.dataset)
+		err := c.FindOrCreateDataset(context.Background(), &tc.dataset)
 
 		if err != nil && tc.err == "" {
 			t.Errorf("Expected no error but got '%s'", err)
@@ -315,7 +316,7 @@ func TestDeleteDataset(t *testing.T) {
 		gbHost = server.URL
 
 		c := NewClient(apiKey)
-		err := c.DeleteDataset(tc.name)
+		err := c.DeleteDataset(context.Background(), tc.name)
 
 		switch {
 		case err == nil && tc.err != "":
@@ -485,7 +486,7 @@ func TestSendAllData(t *testing.T) {
 			},
 		},
 		{
-			//Replace dataset over the batch rows limit sends first 3 and errors
+			//Replace dataset over the batch rows limit replaces with the first 3 and appends the rest
 			dataset: models.Dataset{
 				Name:       "app.build.costs",
 				UpdateType: models.Replace,
@@ -518,9 +519,13 @@ func TestSendAllData(t *testing.T) {
 					Path:   "/datasets/app.build.costs/data",
 					Body:   `{"data":[{"app":"acceptance","cost":4421},{"app":"redis","cost":221},{"app":"api","cost":212}]}`,
 				},
+				{
+					Method: http.MethodPost,
+					Path:   "/datasets/app.build.costs/data",
+					Body:   `{"data":[{"app":"integration","cost":121}]}`,
+				},
 			},
 			maxRows: 3,
-			err:     fmt.Sprintf(errMoreRowsToSend, 4, 3),
 		},
 		{
 			//Append dataset sends all data in batches
@@ -686,7 +691,7 @@ func TestSendAllData(t *testing.T) {
 		gbHost = server.URL
 
 		c := NewClient(apiKey)
-		err := c.SendAllData(&tc.dataset, tc.data)
+		err := c.SendAllData(context.Background(), &tc.dataset, tc.data)
 
 		if err != nil && tc.err == "" {
 			t.Errorf("Expected no error but got '%s'", err)
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"github.com/geckoboard/sql-dataset/models"
+)
+
+// clients holds a Geckoboard client for each account datasets are
+// pushed to, keyed by name with the geckoboard_api_key under ""
+type clients map[string]*Client
+
+func newClients(config *models.Config) clients {
+	cs := make(clients)
+
+	if config.GeckoboardAPIKey != "" {
+		cs[""] = NewClient(config.GeckoboardAPIKey)
+	}
+
+	for _, name := range config.AccountNames() {
+		if acc := config.GeckoboardAccounts[name]; acc != nil {
+			cs[name] = NewClient(acc.APIKey)
+		}
+	}
+
+	retry := newRetryPolicy(config.Retries)
+
+	// Each account has its own limit so gets its own limiter
+	for _, c := range cs {
+		c.retry = retry
+		c.limit = newRateLimiter(config.RateLimit)
+	}
+
+	return cs
+}
+
+// forDataset returns the client for the account the dataset is pushed to
+func (cs clients) forDataset(config *models.Config, ds models.Dataset) (*Client, error) {
+	name, _, err := config.APIKeyFor(ds)
+	if err != nil {
+		return nil, err
+	}
+
+	return cs[name], nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/geckoboard/sql-dataset/drivers"
+	"github.com/geckoboard/sql-dataset/models"
+)
+
+// databases holds an open connection pool for each database the
+// datasets query, keyed by name with the database config under ""
+type databases map[string]*sql.DB
+
+// openDatabases connects to every database referenced by a dataset,
+// any pools already opened are closed if one of them fails
+func openDatabases(config *models.Config) (databases, error) {
+	dbs := make(databases)
+
+	for _, ds := range config.Datasets {
+		name, dc, err := config.DatabaseFor(ds)
+		if err != nil {
+			dbs.Close()
+			return nil, &configError{err}
+		}
+
+		if _, ok := dbs[name]; ok {
+			continue
+		}
+
+		db, err := openDatabase(dc)
+		if err != nil {
+			dbs.Close()
+
+			if name != "" {
+				return nil, fmt.Errorf("Database %q: %w", name, err)
+			}
+
+			return nil, err
+		}
+
+		dbs[name] = db
+	}
+
+	return dbs, nil
+}
+
+func openDatabase(dc *models.DatabaseConfig) (*sql.DB, error) {
+	b, err := drivers.NewConnStringBuilder(dc.Driver)
+	if err != nil {
+		return nil, &configError{err}
+	}
+
+	dsn, err := b.Build(dc)
+	if err != nil {
+		return nil, &configError{fmt.Errorf("There was an error while trying to build "+
+			"your database connection string: %s", err)}
+	}
+
+	return newDBConnection(dc.Driver, dsn)
+}
+
+// Close closes every connection pool
+func (dbs databases) Close() {
+	for _, db := range dbs {
+		db.Close()
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/geckoboard/sql-dataset/models"
+)
+
+// listedDataset is a dataset in one of the Geckoboard accounts
+type listedDataset struct {
+	account    string
+	name       string
+	fields     int
+	configured bool
+}
+
+// listDatasets returns the datasets in each Geckoboard account, marking
+// those defined in the config so the rest can be pruned
+func listDatasets(ctx context.Context, config *models.Config, cs clients) ([]listedDataset, error) {
+	configured := make(map[[2]string]bool)
+
+	for _, ds := range config.Datasets {
+		name, _, err := config.APIKeyFor(ds)
+		if err != nil {
+			return nil, err
+		}
+
+		configured[[2]string{name, ds.Name}] = true
+	}
+
+	accounts := make([]string, 0, len(cs))
+	for name := range cs {
+		accounts = append(accounts, name)
+	}
+
+	sort.Strings(accounts)
+
+	var list []listedDataset
+
+	for _, acc := range accounts {
+		remote, err := cs[acc].ListDatasets(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		sort.Slice(remote, func(i, j int) bool { return remote[i].ID < remote[j].ID })
+
+		for _, ds := range remote {
+			list = append(list, listedDataset{
+				account:    acc,
+				name:       ds.ID,
+				fields:     len(ds.Fields),
+				configured: configured[[2]string{acc, ds.ID}],
+			})
+		}
+	}
+
+	return list, nil
+}
+
+// printDatasetList writes a table of the datasets, with
+// the account column only when named accounts are used
+func printDatasetList(w io.Writer, list []listedDataset) {
+	showAccount := false
+	for _, ds := range list {
+		if ds.account != "" {
+			showAccount = true
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	if showAccount {
+		fmt.Fprint(tw, "ACCOUNT\t")
+	}
+
+	fmt.Fprintln(tw, "DATASET\tFIELDS\tIN CONFIG")
+
+	for _, ds := range list {
+		if showAccount {
+			acc := ds.account
+			if acc == "" {
+				acc = "-"
+			}
+
+			fmt.Fprintf(tw, "%s\t", acc)
+		}
+
+		inConfig := "no"
+		if ds.configured {
+			inConfig = "yes"
+		}
+
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", ds.name, ds.fields, inConfig)
+	}
+
+	tw.Flush()
+}
+
+// unconfiguredDatasets returns the datasets not defined in the config
+func unconfiguredDatasets(list []listedDataset) []listedDataset {
+	var out []listedDataset
+
+	for _, ds := range list {
+		if !ds.configured {
+			out = append(out, ds)
+		}
+	}
+
+	return out
+}
+
+// datasetsToDelete returns the datasets named in the comma separated list,
+// each in the account it is pushed to. Glob patterns are matched against
+// the names of the datasets in the config, while any other name which isn't
+// in the config is deleted from the -account flag account.
+func datasetsToDelete(names string, config *models.Config, cs clients) ([]listedDataset, error) {
+	var (
+		list []listedDataset
+		seen = make(map[string]bool)
+	)
+
+	add := func(ds models.Dataset) error {
+		if seen[ds.Name] {
+			return nil
+		}
+
+		acc, _, err := config.APIKeyFor(ds)
+		if err != nil {
+			return err
+		}
+
+		if cs[acc] == nil {
+			return fmt.Errorf(`No Geckoboard API key for the account "%s"`, acc)
+		}
+
+		seen[ds.Name] = true
+		list = append(list, listedDataset{account: acc, name: ds.Name})
+		return nil
+	}
+
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+
+		if name == "" {
+			continue
+		}
+
+		if !strings.ContainsAny(name, "*?[") {
+			if err := add(datasetToDelete(name, config)); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		matched := false
+
+		for _, ds := range config.Datasets {
+			ok, err := path.Match(name, ds.Name)
+			if err != nil {
+				return nil, fmt.Errorf(`"%s" is not a valid pattern: %s`, name, err)
+			}
+
+			if !ok {
+				continue
+			}
+
+			matched = true
+
+			if err := add(ds); err != nil {
+				return nil, err
+			}
+		}
+
+		if !matched {
+			return nil, fmt.Errorf(`No dataset in the config matches "%s"`, name)
+		}
+	}
+
+	return list, nil
+}
+
+// deleteDatasets deletes each of the datasets from its account, carrying
+// on past failures so every one is tried, and returns how many failed. What
+// was last sent for a deleted dataset is cleared from the state so its next
+// update recreates it in full.
+func deleteDatasets(ctx context.Context, config *models.Config, cs clients, st *state, list []listedDataset) (failed int) {
+	for _, ds := range list {
+		if err := cs[ds.account].DeleteDataset(ctx, ds.name); err != nil {
+			logs.err(fmt.Sprintf("Failed to delete the dataset %s: %s", ds.name, err),
+				fields{"dataset": ds.name, "phase": "delete", "error": err})
+			failed++
+			continue
+		}
+
+		logs.info(fmt.Sprintf("Deleted dataset %s", ds.name), fields{"dataset": ds.name, "phase": "delete"})
+
+		// The state is kept by dataset name, so it's left alone when
+		// the config sends a dataset of that name to another account
+		if acc, ok := configuredAccount(config, ds.name); ok && acc != ds.account {
+			continue
+		}
+
+		if err := st.forget(ds.name); err != nil {
+			logs.warn(fmt.Sprintf("Failed to clear the dataset %s from the state file: %s", ds.name, err),
+				fields{"dataset": ds.name, "phase": "state", "error": err})
+		}
+	}
+
+	return failed
+}
+
+// configuredAccount returns the account the config
+// sends the named dataset to, if it's in the config
+func configuredAccount(config *models.Config, name string) (string, bool) {
+	for _, ds := range config.Datasets {
+		if ds.Name != name {
+			continue
+		}
+
+		acc, _, err := config.APIKeyFor(ds)
+		return acc, err == nil
+	}
+
+	return "", false
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/geckoboard/sql-dataset/models"
+)
+
+func TestListAndPruneDatasets(t *testing.T) {
+	remote := map[string]string{
+		"defaultKey":   `{"data":[{"id":"app.builds","fields":{"count":{"type":"number","name":"Count"}}},{"id":"app.old","fields":{}}]}`,
+		"marketingKey": `{"data":[{"id":"app.visits","fields":{"day":{"type":"date","name":"Day"},"visits":{"type":"number","name":"Visits"}}},{"id":"app.builds","fields":{}}]}`,
+	}
+
+	var deleted []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, _, _ := r.BasicAuth()
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/datasets":
+			fmt.Fprint(w, remote[key])
+		case r.Method == http.MethodDelete:
+			deleted = append(deleted, key+" "+r.URL.Path)
+			fmt.Fprint(w, `{}`)
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+
+	defer server.Close()
+	gbHost = server.URL
+
+	config := &models.Config{
+		GeckoboardAPIKey: "defaultKey",
+		GeckoboardAccounts: map[string]*models.GeckoboardAccount{
+			"marketing": {APIKey: "marketingKey"},
+		},
+		Datasets: []models.Dataset{
+			{Name: "app.builds"},
+			{Name: "app.visits", Account: "marketing"},
+		},
+	}
+
+	cs := clients{"": NewClient("defaultKey"), "marketing": NewClient("marketingKey")}
+
+	list, err := listDatasets(context.Background(), config, cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expList := []listedDataset{
+		{account: "", name: "app.builds", fields: 1, configured: true},
+		{account: "", name: "app.old", fields: 0, configured: false},
+		{account: "marketing", name: "app.builds", fields: 0, configured: false},
+		{account: "marketing", name: "app.visits", fields: 2, configured: true},
+	}
+
+	if !reflect.DeepEqual(list, expList) {
+		t.Fatalf("Expected datasets %+v but got %+v", expList, list)
+	}
+
+	var buf bytes.Buffer
+	printDatasetList(&buf, list)
+
+	exp := `ACCOUNT    DATASET     FIELDS  IN CONFIG
+-          app.builds  1       yes
+-          app.old     0       no
+marketing  app.builds  0       no
+marketing  app.visits  2       yes
+`
+
+	if buf.String() != exp {
+		t.Errorf("Expected list\n%s\nbut got\n%s", exp, buf.String())
+	}
+
+	buf.Reset()
+
+	defer func(l *logger) { logs = l }(logs)
+	logs = &logger{w: &buf, level: infoLevel, now: time.Now}
+
+	st := &state{
+		Datasets: map[string]*datasetState{
+			"app.builds": {PayloadHash: "abc", LastValue: "12"},
+			"app.old":    {PayloadHash: "def", LastValue: "34"},
+		},
+		readOnly: true,
+	}
+
+	if failed := deleteDatasets(context.Background(), config, cs, st, unconfiguredDatasets(list)); failed != 0 {
+		t.Fatalf("Expected no failed deletes but got %d", failed)
+	}
+
+	// Only the state of the deleted dataset is cleared, not that of the
+	// dataset with the same name the config sends to another account
+	expState := map[string]*datasetState{
+		"app.builds": {PayloadHash: "abc", LastValue: "12"},
+		"app.old":    {},
+	}
+
+	if !reflect.DeepEqual(st.Datasets, expState) {
+		t.Errorf("Expected state %v but got %v", expState, st.Datasets)
+	}
+
+	expDeleted := []string{"defaultKey /datasets/app.old", "marketingKey /datasets/app.builds"}
+
+	if !reflect.DeepEqual(deleted, expDeleted) {
+		t.Errorf("Expected deletes %v but got %v", expDeleted, deleted)
+	}
+
+	expOut := "Deleted dataset app.old\nDeleted dataset app.builds\n"
+
+	if buf.String() != expOut {
+		t.Errorf("Expected output %q but got %q", expOut, buf.String())
+	}
+}
+
+func TestPrintDatasetListWithoutAccounts(t *testing.T) {
+	var buf bytes.Buffer
+
+	printDatasetList(&buf, []listedDataset{
+		{name: "app.builds", fields: 3, configured: true},
+		{name: "app.old", fields: 1},
+	})
+
+	exp := `DATASET     FIELDS  IN CONFIG
+app.builds  3       yes
+app.old     1       no
+`
+
+	if buf.String() != exp {
+		t.Errorf("Expected list\n%s\nbut got\n%s", exp, buf.String())
+	}
+}
+
+func TestDatasetsToDelete(t *testing.T) {
+	config := &models.Config{
+		GeckoboardAPIKey: "defaultKey",
+		GeckoboardAccounts: map[string]*models.GeckoboardAccount{
+			"marketing": {APIKey: "marketingKey"},
+		},
+		Datasets: []models.Dataset{
+			{Name: "app.builds"},
+			{Name: "app.costs"},
+			{Name: "web.visits", Account: "marketing"},
+		},
+	}
+
+	cs := clients{"": NewClient("defaultKey"), "marketing": NewClient("marketingKey")}
+
+	testCases := []struct {
+		names string
+		list  []listedDataset
+		err   string
+	}{
+		{
+			names: "app.costs",
+			list:  []listedDataset{{name: "app.costs"}},
+		},
+		{
+			// Names not in the config are deleted from the default account
+			names: "app.old, web.visits",
+			list:  []listedDataset{{name: "app.old"}, {account: "marketing", name: "web.visits"}},
+		},
+		{
+			names: "app.*",
+			list:  []listedDataset{{name: "app.builds"}, {name: "app.costs"}},
+		},
+		{
+			// Each dataset is only deleted once
+			names: "*.visits,web.visits,app.b*",
+			list:  []listedDataset{{account: "marketing", name: "web.visits"}, {name: "app.builds"}},
+		},
+		{
+			names: "app.costs,other.*",
+			err:   `No dataset in the config matches "other.*"`,
+		},
+		{
+			names: "app.[",
+			err:   `"app.[" is not a valid pattern: syntax error in pattern`,
+		},
+		{
+			names: " , ",
+		},
+	}
+
+	for i, tc := range testCases {
+		list, err := datasetsToDelete(tc.names, config, cs)
+
+		switch {
+		case err == nil && tc.err != "":
+			t.Errorf("[%d] Expected error %q but got none", i, tc.err)
+		case err != nil && err.Error() != tc.err:
+			t.Errorf("[%d] Expected error %q but got %q", i, tc.err, err)
+		}
+
+		if !reflect.DeepEqual(list, tc.list) {
+			t.Errorf("[%d] Expected datasets %+v but got %+v", i, tc.list, list)
+		}
+	}
+}
+
+func TestDeleteDatasetsCarriesOnAfterFailure(t *testing.T) {
+	var paths []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+
+		if r.URL.Path == "/datasets/app.missing" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"message":"Dataset not found"}}`)
+			return
+		}
+
+		fmt.Fprint(w, `{}`)
+	}))
+
+	defer server.Close()
+	gbHost = server.URL
+
+	cs := clients{"": NewClient(apiKey)}
+	list := []listedDataset{{name: "app.builds"}, {name: "app.missing"}, {name: "app.costs"}}
+
+	var buf bytes.Buffer
+
+	defer func(l *logger) { logs = l }(logs)
+	logs = &logger{w: &buf, json: true, level: infoLevel, now: func() time.Time { return time.Date(2021, time.March, 10, 14, 23, 45, 0, time.UTC) }}
+
+	if failed := deleteDatasets(context.Background(), &models.Config{}, cs, nil, list); failed != 1 {
+		t.Errorf("Expected one failed delete but got %d", failed)
+	}
+
+	expPaths := []string{"/datasets/app.builds", "/datasets/app.missing", "/datasets/app.costs"}
+
+	if !reflect.DeepEqual(paths, expPaths) {
+		t.Errorf("Expected requests %v but got %v", expPaths, paths)
+	}
+
+	failure := fmt.Sprintf(errInvalidPayload, "Dataset not found")
+
+	expOut := `{"time":"2021-03-10T14:23:45Z","level":"info","msg":"Deleted dataset app.builds","dataset":"app.builds","phase":"delete"}` + "\n" +
+		`{"time":"2021-03-10T14:23:45Z","level":"error","msg":"Failed to delete the dataset app.missing: ` + failure +
+		`","dataset":"app.missing","error":"` + failure + `","phase":"delete"}` + "\n" +
+		`{"time":"2021-03-10T14:23:45Z","level":"info","msg":"Deleted dataset app.costs","dataset":"app.costs","phase":"delete"}` + "\n"
+
+	if buf.String() != expOut {
+		t.Errorf("Expected output\n%s\nbut got\n%s", expOut, buf.String())
+	}
+
+	if err := deletionError(1, 3); err == nil || err.Error() != "1 of the 3 datasets failed to delete" {
+		t.Errorf("Expected the deletion error but got %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// dryRunTransport writes each request the client would send to Geckoboard
+// to w instead, responding as if it succeeded. As it sits beneath the
+// client the output is exactly what a real run sends, batching included.
+type dryRunTransport struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (t *dryRunTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body bytes.Buffer
+
+	if req.Body != nil {
+		b, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(bytes.TrimSpace(b)) > 0 {
+			if err := json.Indent(&body, b, "", "  "); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	fmt.Fprintf(t.w, "%s %s\n", req.Method, req.URL.Path)
+
+	if body.Len() > 0 {
+		fmt.Fprintf(t.w, "%s\n", strings.TrimSpace(body.String()))
+	}
+
+	fmt.Fprintln(t.w, "")
+
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+		Body:       ioutil.NopCloser(strings.NewReader("{}")),
+		Request:    req,
+	}, nil
+}
+
+// dryRun makes every client write its requests to w rather than
+// sending them, as nothing is sent there is no need to rate limit
+func (cs clients) dryRun(w io.Writer) {
+	t := &dryRunTransport{w: w}
+
+	for _, c := range cs {
+		c.client = &http.Client{Transport: t}
+		c.limit = nil
+	}
+}
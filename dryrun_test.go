@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/geckoboard/sql-dataset/models"
+)
+
+func TestDryRun(t *testing.T) {
+	maxRows = 3
+	defer func() { maxRows = originalBatchRows }()
+
+	// Any request reaching the network would fail
+	gbHost = "http://127.0.0.1:0"
+
+	config := models.Config{
+		GeckoboardAPIKey: "fakeKey",
+		RateLimit:        &models.RateLimitConfig{RequestsPerMinute: 1},
+		DatabaseConfig: &models.DatabaseConfig{
+			Driver: models.SQLiteDriver,
+			URL:    filepath.Join("models", "fixtures", "db.sqlite"),
+		},
+		Datasets: []models.Dataset{
+			{
+				Name:       "app.counts",
+				SQL:        "SELECT app_name, count(*) FROM builds GROUP BY app_name order by app_name",
+				UpdateType: models.Append,
+				Fields: []models.Field{
+					{Name: "App", Type: models.StringType},
+					{Name: "Build Count", Type: models.NumberType},
+				},
+			},
+		},
+	}
+
+	db, err := newDBConnection(config.DatabaseConfig.Driver, config.DatabaseConfig.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+
+	cs := newClients(&config)
+	cs.dryRun(&buf)
+
+	if processAllDatasets(&config, cs, databases{"": db}, nil) != exitOK {
+		t.Fatal("Expected dry run to succeed")
+	}
+
+	exp := `PUT /datasets/app.counts
+{
+  "id": "app.counts",
+  "fields": {
+    "app": {
+      "type": "string",
+      "name": "App"
+    },
+    "build_count": {
+      "type": "number",
+      "name": "Build Count"
+    }
+  }
+}
+
+POST /datasets/app.counts/data
+{
+  "data": [
+    {
+      "app": "",
+      "build_count": 2
+    },
+    {
+      "app": "everdeen",
+      "build_count": 2
+    },
+    {
+      "app": "geckoboard-ruby",
+      "build_count": 3
+    }
+  ]
+}
+
+POST /datasets/app.counts/data
+{
+  "data": [
+    {
+      "app": "react",
+      "build_count": 1
+    },
+    {
+      "app": "westworld",
+      "build_count": 1
+    }
+  ]
+}
+
+`
+
+	if buf.String() != exp {
+		t.Errorf("Expected dry run output %s but got %s", exp, buf.String())
+	}
+}
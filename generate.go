@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/geckoboard/sql-dataset/models"
+	"gopkg.in/yaml.v2"
+)
+
+// generateFields runs the query for the named dataset and writes the
+// fields inferred from its result columns as YAML, ready to be reviewed
+// and copied into the config
+func generateFields(w io.Writer, name string, config *models.Config) error {
+	ds, dc, db, err := openDatasetDatabase(name, config)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	fields, err := ds.InferredFields(context.Background(), dc, db)
+	if err != nil {
+		return err
+	}
+
+	b, err := yaml.Marshal(struct {
+		Fields []models.Field `yaml:"fields"`
+	}{fields})
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "# Fields inferred for the dataset %s, check them before use\n", ds.Name)
+	_, err = w.Write(b)
+	return err
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/geckoboard/sql-dataset/models"
+)
+
+func TestGenerateFields(t *testing.T) {
+	config := models.Config{
+		DatabaseConfig: &models.DatabaseConfig{
+			Driver:   models.SQLiteDriver,
+			Database: filepath.Join("models", "fixtures", "db.sqlite"),
+		},
+		Datasets: []models.Dataset{
+			{
+				Name:        "app.builds",
+				SQL:         "SELECT app_name, run_time, created_at FROM builds",
+				InferFields: true,
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+
+	if err := generateFields(&buf, "app.builds", &config); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `# Fields inferred for the dataset app.builds, check them before use
+fields:
+- type: string
+  name: app_name
+- type: number
+  name: run_time
+  optional: true
+- type: datetime
+  name: created_at
+`
+
+	if buf.String() != exp {
+		t.Errorf("Expected fields\n%s\nbut got\n%s", exp, buf.String())
+	}
+
+	if err := generateFields(&buf, "app.missing", &config); err == nil || err.Error() != `No dataset named "app.missing" found in the config` {
+		t.Errorf("Expected missing dataset error but got %v", err)
+	}
+}
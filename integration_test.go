@@ -1,13 +1,18 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/geckoboard/sql-dataset/models"
 )
@@ -103,7 +108,7 @@ func TestEndToEndFlow(t *testing.T) {
 			},
 		},
 		{
-			// Replace update type sends the first batch only
+			// Replace update type replaces with the first batch and appends the rest
 			config: models.Config{
 				DatabaseConfig: &models.DatabaseConfig{
 					Driver: models.SQLiteDriver,
@@ -121,8 +126,7 @@ func TestEndToEndFlow(t *testing.T) {
 					},
 				},
 			},
-			maxRows:     4,
-			expectError: true,
+			maxRows: 4,
 			gbReqs: []GBRequest{
 				{
 					Path: "/datasets/apps.run.time",
@@ -132,6 +136,14 @@ func TestEndToEndFlow(t *testing.T) {
 					Path: "/datasets/apps.run.time/data",
 					Body: `{"data":[{"app":"","run_time":0.12349876543},{"app":"","run_time":46.432763287},{"app":"everdeen","run_time":0.31882276212},{"app":"everdeen","run_time":144.31838122382}]}`,
 				},
+				{
+					Path: "/datasets/apps.run.time/data",
+					Body: `{"data":[{"app":"geckoboard-ruby","run_time":0.21882232124},{"app":"geckoboard-ruby","run_time":77.21381276421},{"app":"geckoboard-ruby","run_time":0},{"app":"react","run_time":118.18382961212}]}`,
+				},
+				{
+					Path: "/datasets/apps.run.time/data",
+					Body: `{"data":[{"app":"westworld","run_time":321.93774373}]}`,
+				},
 			},
 		},
 		{
@@ -322,7 +334,6 @@ func TestEndToEndFlow(t *testing.T) {
 			fmt.Fprintf(w, `{}`)
 		}))
 
-		client := NewClient("fakeKey")
 		dc := tc.config.DatabaseConfig
 		db, err := newDBConnection(dc.Driver, dc.URL)
 		if err != nil {
@@ -331,10 +342,10 @@ func TestEndToEndFlow(t *testing.T) {
 
 		gbHost = gbWS.URL
 
-		bol := processAllDatasets(&tc.config, client, db)
+		code := processAllDatasets(&tc.config, clients{"": NewClient("fakeKey")}, databases{"": db}, nil)
 
-		if tc.expectError != bol {
-			t.Errorf("[%d] Expected hasErrors to be %t but got %t", i, tc.expectError, bol)
+		if tc.expectError != (code != exitOK) {
+			t.Errorf("[%d] Expected hasErrors to be %t but got the exit code %d", i, tc.expectError, code)
 		}
 
 		if tc.gbHits != len(tc.gbReqs) {
@@ -343,3 +354,672 @@ func TestEndToEndFlow(t *testing.T) {
 		gbWS.Close()
 	}
 }
+
+func TestProcessDatasetsConcurrently(t *testing.T) {
+	maxRows = originalBatchRows
+
+	config := models.Config{
+		MaxConcurrency: 3,
+		DatabaseConfig: &models.DatabaseConfig{
+			Driver: models.SQLiteDriver,
+			URL:    filepath.Join("models", "fixtures", "db.sqlite"),
+		},
+	}
+
+	for _, name := range []string{"app.one", "app.two", "app.three", "app.four"} {
+		config.Datasets = append(config.Datasets, models.Dataset{
+			Name:       name,
+			SQL:        "SELECT app_name, count(*) FROM builds GROUP BY app_name order by app_name",
+			UpdateType: models.Replace,
+			Fields: []models.Field{
+				{Name: "App", Type: models.StringType},
+				{Name: "Build Count", Type: models.NumberType},
+			},
+		})
+	}
+
+	var (
+		mu   sync.Mutex
+		hits = make(map[string]int)
+	)
+
+	gbWS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+
+		if r.URL.Path == "/datasets/app.three/data" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `{"error":{"message":"Missing data for 'app'"}}`)
+			return
+		}
+
+		fmt.Fprintf(w, `{}`)
+	}))
+	defer gbWS.Close()
+
+	gbHost = gbWS.URL
+
+	db, err := newDBConnection(config.DatabaseConfig.Driver, config.DatabaseConfig.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := processDatasets(context.Background(), nil, nil, &config, clients{"": NewClient("fakeKey")}, databases{"": db}, nil, config.Datasets)
+
+	if len(results) != len(config.Datasets) {
+		t.Fatalf("Expected %d results but got %d", len(config.Datasets), len(results))
+	}
+
+	for i, r := range results {
+		ds := config.Datasets[i]
+
+		if r.name != ds.Name {
+			t.Errorf("[%d] Expected result for %s but got %s", i, ds.Name, r.name)
+		}
+
+		if r.rows != 5 {
+			t.Errorf("[%d] Expected 5 rows but got %d", i, r.rows)
+		}
+
+		if (r.err != nil) != (ds.Name == "app.three") {
+			t.Errorf("[%d] Unexpected error state for %s: %v", i, ds.Name, r.err)
+		}
+
+		for _, path := range []string{"/datasets/" + ds.Name, "/datasets/" + ds.Name + "/data"} {
+			if hits[path] != 1 {
+				t.Errorf("[%d] Expected one request to %s but got %d", i, path, hits[path])
+			}
+		}
+	}
+}
+
+func TestWorkerCount(t *testing.T) {
+	testCases := []struct {
+		maxConcurrency uint8
+		datasets       int
+		out            int
+	}{
+		{0, 4, 1},
+		{1, 4, 1},
+		{3, 4, 3},
+		{3, 2, 2},
+		{20, 10, maxDBConnections},
+	}
+
+	for i, tc := range testCases {
+		config := models.Config{MaxConcurrency: tc.maxConcurrency}
+
+		if n := workerCount(&config, tc.datasets); n != tc.out {
+			t.Errorf("[%d] Expected %d workers but got %d", i, tc.out, n)
+		}
+	}
+}
+
+func TestProcessDatasetsSkipsWhenShuttingDown(t *testing.T) {
+	config := models.Config{
+		Datasets: []models.Dataset{
+			{Name: "app.one"},
+			{Name: "app.two"},
+		},
+	}
+
+	stop := make(chan struct{})
+	close(stop)
+
+	results := processDatasets(context.Background(), stop, nil, &config, nil, nil, nil, config.Datasets)
+
+	for i, r := range results {
+		if r.name != config.Datasets[i].Name {
+			t.Errorf("[%d] Expected result for %s but got %s", i, config.Datasets[i].Name, r.name)
+		}
+
+		if r.err != errSkippedShutdown {
+			t.Errorf("[%d] Expected skipped error but got %v", i, r.err)
+		}
+	}
+
+	var stats runStats
+	stats.add(append(results, datasetResult{name: "app.three"}, datasetResult{name: "app.four", err: errUnexpectedResponse}))
+
+	if exp := "Shut down after 2 dataset updates, 1 failed and 2 skipped"; stats.String() != exp {
+		t.Errorf("Expected stats %q but got %q", exp, stats.String())
+	}
+}
+
+func TestProcessDatasetsWithNamedDatabases(t *testing.T) {
+	maxRows = originalBatchRows
+
+	config := models.Config{
+		Databases: map[string]*models.DatabaseConfig{
+			"builds": {
+				Driver:   models.SQLiteDriver,
+				Database: filepath.Join("models", "fixtures", "db.sqlite"),
+			},
+			"unused": {
+				Driver:   models.SQLiteDriver,
+				Database: filepath.Join("models", "fixtures", "nonexisting", "db.sqlite"),
+			},
+		},
+		Datasets: []models.Dataset{
+			{
+				Name:       "app.counts",
+				SQL:        "SELECT app_name, count(*) FROM builds GROUP BY app_name order by app_name",
+				UpdateType: models.Replace,
+				Database:   "builds",
+				Fields: []models.Field{
+					{Name: "App", Type: models.StringType},
+					{Name: "Build Count", Type: models.NumberType},
+				},
+			},
+		},
+	}
+
+	dbs, err := openDatabases(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer dbs.Close()
+
+	if len(dbs) != 1 || dbs["builds"] == nil {
+		t.Fatalf("Expected only the builds database to be opened but got %v", dbs)
+	}
+
+	var paths []string
+
+	gbWS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		fmt.Fprintf(w, `{}`)
+	}))
+	defer gbWS.Close()
+
+	gbHost = gbWS.URL
+
+	if processAllDatasets(&config, clients{"": NewClient("fakeKey")}, dbs, nil) != exitOK {
+		t.Error("Expected no errors processing datasets")
+	}
+
+	if len(paths) != 2 {
+		t.Errorf("Expected 2 requests but got %v", paths)
+	}
+
+	config.Datasets[0].Database = "unused"
+
+	if _, err := openDatabases(&config); err == nil || !strings.HasPrefix(err.Error(), `Database "unused": `) {
+		t.Errorf("Expected unused database to fail opening but got %v", err)
+	}
+}
+
+func TestProcessDatasetsWithAccounts(t *testing.T) {
+	maxRows = originalBatchRows
+
+	config := models.Config{
+		GeckoboardAPIKey: "defaultKey",
+		GeckoboardAccounts: map[string]*models.GeckoboardAccount{
+			"agency": {APIKey: "agencyKey"},
+		},
+		DatabaseConfig: &models.DatabaseConfig{
+			Driver: models.SQLiteDriver,
+			URL:    filepath.Join("models", "fixtures", "db.sqlite"),
+		},
+	}
+
+	for name, account := range map[string]string{"app.counts": "", "agency.app.counts": "agency"} {
+		config.Datasets = append(config.Datasets, models.Dataset{
+			Name:       name,
+			SQL:        "SELECT app_name, count(*) FROM builds GROUP BY app_name order by app_name",
+			UpdateType: models.Replace,
+			Account:    account,
+			Fields: []models.Field{
+				{Name: "App", Type: models.StringType},
+				{Name: "Build Count", Type: models.NumberType},
+			},
+		})
+	}
+
+	apiKeys := make(map[string]string)
+
+	gbWS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiKeys[r.URL.Path], _, _ = r.BasicAuth()
+		fmt.Fprintf(w, `{}`)
+	}))
+	defer gbWS.Close()
+
+	gbHost = gbWS.URL
+
+	db, err := newDBConnection(config.DatabaseConfig.Driver, config.DatabaseConfig.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if processAllDatasets(&config, newClients(&config), databases{"": db}, nil) != exitOK {
+		t.Error("Expected no errors processing datasets")
+	}
+
+	expKeys := map[string]string{
+		"/datasets/app.counts":             "defaultKey",
+		"/datasets/app.counts/data":        "defaultKey",
+		"/datasets/agency.app.counts":      "agencyKey",
+		"/datasets/agency.app.counts/data": "agencyKey",
+	}
+
+	if !reflect.DeepEqual(apiKeys, expKeys) {
+		t.Errorf("Expected api keys %v but got %v", expKeys, apiKeys)
+	}
+
+	for name, exp := range map[string]string{"agency.app.counts": "agency", "other.dataset": ""} {
+		if ds := datasetToDelete(name, &config); ds.Account != exp {
+			t.Errorf("Expected %s to be deleted from account %q but got %q", name, exp, ds.Account)
+		}
+	}
+}
+
+func TestProcessIncrementalDataset(t *testing.T) {
+	maxRows = originalBatchRows
+
+	dir, err := ioutil.TempDir("", "sql-dataset")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	config := models.Config{
+		DatabaseConfig: &models.DatabaseConfig{
+			Driver: models.SQLiteDriver,
+			URL:    filepath.Join("models", "fixtures", "db.sqlite"),
+		},
+		StateFile: filepath.Join(dir, "state.json"),
+		Datasets: []models.Dataset{
+			{
+				Name:         "app.builds",
+				SQL:          "SELECT id, app_name FROM builds WHERE id > {{ last_value }} ORDER BY id",
+				UpdateType:   models.Append,
+				CursorColumn: "id",
+				InitialValue: "6",
+				Fields: []models.Field{
+					{Name: "ID", Type: models.NumberType},
+					{Name: "App", Type: models.StringType},
+				},
+			},
+		},
+	}
+
+	var bodies []string
+
+	gbWS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/datasets/app.builds/data" {
+			b, _ := ioutil.ReadAll(r.Body)
+			bodies = append(bodies, strings.TrimSpace(string(b)))
+		}
+
+		fmt.Fprintf(w, `{}`)
+	}))
+	defer gbWS.Close()
+
+	gbHost = gbWS.URL
+
+	db, err := newDBConnection(config.DatabaseConfig.Driver, config.DatabaseConfig.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		st, err := loadState(&config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if processAllDatasets(&config, clients{"": NewClient("fakeKey")}, databases{"": db}, st) != exitOK {
+			t.Fatalf("[%d] Expected no errors processing datasets", i)
+		}
+	}
+
+	// The second run finds nothing newer to send
+	exp := []string{`{"data":[{"app":"geckoboard-ruby","id":7},{"app":"","id":8},{"app":"","id":9}]}`}
+
+	if !reflect.DeepEqual(bodies, exp) {
+		t.Errorf("Expected data sent %v but got %v", exp, bodies)
+	}
+
+	st, err := loadState(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := st.lastValue("app.builds"); v != "9" {
+		t.Errorf("Expected last value 9 to be saved but got %q", v)
+	}
+
+	// The last run is recorded too
+	if ds := st.Datasets["app.builds"]; ds.Rows != 0 || ds.Error != "" || ds.PayloadHash == "" || ds.LastRun.IsZero() {
+		t.Errorf("Expected the second run with no rows to be recorded but got %#v", ds)
+	}
+}
+
+func TestProcessIncrementalDatasetSavesEachBatch(t *testing.T) {
+	maxRows = 2
+	defer func() { maxRows = originalBatchRows }()
+
+	dir, err := ioutil.TempDir("", "sql-dataset")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	config := models.Config{
+		DatabaseConfig: &models.DatabaseConfig{
+			Driver: models.SQLiteDriver,
+			URL:    filepath.Join("models", "fixtures", "db.sqlite"),
+		},
+		StateFile: filepath.Join(dir, "state.json"),
+		Datasets: []models.Dataset{
+			{
+				Name:         "app.builds",
+				SQL:          "SELECT id FROM builds WHERE id > {{ last_value }} ORDER BY id",
+				UpdateType:   models.Append,
+				CursorColumn: "id",
+				InitialValue: "6",
+				Fields:       []models.Field{{Name: "ID", Type: models.NumberType}},
+			},
+		},
+	}
+
+	var (
+		bodies []string
+		fail   = true
+	)
+
+	gbWS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/datasets/app.builds/data" {
+			b, _ := ioutil.ReadAll(r.Body)
+			bodies = append(bodies, strings.TrimSpace(string(b)))
+
+			// The second batch of the first run fails
+			if fail && len(bodies) == 2 {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error":{"message":"Bad request"}}`)
+				return
+			}
+		}
+
+		fmt.Fprintf(w, `{}`)
+	}))
+	defer gbWS.Close()
+
+	gbHost = gbWS.URL
+
+	db, err := newDBConnection(config.DatabaseConfig.Driver, config.DatabaseConfig.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, exp := range []int{exitAPI, exitOK} {
+		st, err := loadState(&config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if code := processAllDatasets(&config, clients{"": NewClient("fakeKey")}, databases{"": db}, st); code != exp {
+			t.Fatalf("[%d] Expected exit code %d but got %d", i, exp, code)
+		}
+
+		if i == 0 {
+			if v := st.lastValue("app.builds"); v != "8" {
+				t.Errorf("Expected the first batch's last value 8 to be saved but got %q", v)
+			}
+		}
+
+		fail = false
+	}
+
+	// Only the batch which failed is sent again
+	exp := []string{
+		`{"data":[{"id":7},{"id":8}]}`,
+		`{"data":[{"id":9}]}`,
+		`{"data":[{"id":9}]}`,
+	}
+
+	if !reflect.DeepEqual(bodies, exp) {
+		t.Errorf("Expected data sent %v but got %v", exp, bodies)
+	}
+}
+
+func TestProcessRecreatedIncrementalDataset(t *testing.T) {
+	maxRows = originalBatchRows
+
+	dir, err := ioutil.TempDir("", "sql-dataset")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	config := models.Config{
+		DatabaseConfig: &models.DatabaseConfig{
+			Driver: models.SQLiteDriver,
+			URL:    filepath.Join("models", "fixtures", "db.sqlite"),
+		},
+		StateFile: filepath.Join(dir, "state.json"),
+		Datasets: []models.Dataset{
+			{
+				Name:         "app.builds",
+				SQL:          "SELECT id FROM builds WHERE id > {{ last_value }} ORDER BY id",
+				UpdateType:   models.Append,
+				CursorColumn: "id",
+				InitialValue: "6",
+				AutoRecreate: true,
+				Fields:       []models.Field{{Name: "ID", Type: models.NumberType}},
+			},
+		},
+	}
+
+	var (
+		bodies  []string
+		created bool
+	)
+
+	gbWS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && !created:
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprint(w, `{"error":{"message":"Fields don't match"}}`)
+		case r.Method == http.MethodGet:
+			fmt.Fprint(w, `{"id":"app.builds","fields":{"name":{"type":"string","name":"Name"}}}`)
+		case r.Method == http.MethodDelete:
+			created = true
+			fmt.Fprint(w, `{}`)
+		case r.URL.Path == "/datasets/app.builds/data":
+			b, _ := ioutil.ReadAll(r.Body)
+			bodies = append(bodies, strings.TrimSpace(string(b)))
+			fmt.Fprint(w, `{}`)
+		default:
+			fmt.Fprint(w, `{}`)
+		}
+	}))
+	defer gbWS.Close()
+
+	gbHost = gbWS.URL
+
+	db, err := newDBConnection(config.DatabaseConfig.Driver, config.DatabaseConfig.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := loadState(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := st.setLastValue("app.builds", "8"); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := processAllDatasets(&config, clients{"": NewClient("fakeKey")}, databases{"": db}, st); code != exitOK {
+		t.Fatalf("Expected exit code %d but got %d", exitOK, code)
+	}
+
+	// Every row from the cursor_initial_value is sent in the same run
+	exp := []string{`{"data":[{"id":7},{"id":8},{"id":9}]}`}
+
+	if !reflect.DeepEqual(bodies, exp) {
+		t.Errorf("Expected data sent %v but got %v", exp, bodies)
+	}
+
+	if v := st.lastValue("app.builds"); v != "9" {
+		t.Errorf("Expected last value 9 to be saved but got %q", v)
+	}
+}
+
+func TestProcessDatasetsSkipsUnchanged(t *testing.T) {
+	maxRows = originalBatchRows
+
+	dir, err := ioutil.TempDir("", "sql-dataset")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	config := models.Config{
+		DatabaseConfig: &models.DatabaseConfig{
+			Driver: models.SQLiteDriver,
+			URL:    filepath.Join("models", "fixtures", "db.sqlite"),
+		},
+		StateFile:     filepath.Join(dir, "state.json"),
+		SkipUnchanged: &models.SkipUnchangedConfig{MaxInterval: time.Hour},
+		Datasets: []models.Dataset{
+			{
+				Name:       "app.counts",
+				SQL:        "SELECT app_name, count(*) FROM builds GROUP BY app_name order by app_name",
+				UpdateType: models.Replace,
+				Fields: []models.Field{
+					{Name: "App", Type: models.StringType},
+					{Name: "Build Count", Type: models.NumberType},
+				},
+			},
+		},
+	}
+
+	var sent int
+
+	gbWS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/datasets/app.counts/data" {
+			sent++
+		}
+
+		fmt.Fprintf(w, `{}`)
+	}))
+	defer gbWS.Close()
+
+	gbHost = gbWS.URL
+
+	db, err := newDBConnection(config.DatabaseConfig.Driver, config.DatabaseConfig.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := loadState(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cs := clients{"": NewClient("fakeKey")}
+
+	for i, exp := range []int{1, 1} {
+		if processAllDatasets(&config, cs, databases{"": db}, st) != exitOK {
+			t.Fatalf("[%d] Expected no errors processing datasets", i)
+		}
+
+		if sent != exp {
+			t.Errorf("[%d] Expected %d updates sent but got %d", i, exp, sent)
+		}
+	}
+
+	if !st.Datasets["app.counts"].Unchanged {
+		t.Error("Expected the skipped update to be recorded as unchanged")
+	}
+
+	// Unchanged data is sent again once the max interval has passed
+	st.Datasets["app.counts"].LastPushed = time.Now().Add(-2 * time.Hour)
+
+	if processAllDatasets(&config, cs, databases{"": db}, st); sent != 2 {
+		t.Errorf("Expected the update to be sent after the max interval but got %d sent", sent)
+	}
+
+	// Changed data is always sent
+	config.Datasets[0].SQL = "SELECT app_name, count(*) FROM builds WHERE id > 1 GROUP BY app_name order by app_name"
+
+	if processAllDatasets(&config, cs, databases{"": db}, st); sent != 3 {
+		t.Errorf("Expected the changed data to be sent but got %d sent", sent)
+	}
+
+	// As is the same data with a changed schema
+	config.Datasets[0].Fields[1].Optional = true
+
+	if processAllDatasets(&config, cs, databases{"": db}, st); sent != 4 {
+		t.Errorf("Expected the data to be sent with the changed schema but got %d sent", sent)
+	}
+
+	config.Datasets[0].UniqueBy = []string{"App"}
+
+	if processAllDatasets(&config, cs, databases{"": db}, st); sent != 5 {
+		t.Errorf("Expected the data to be sent with the changed unique_by but got %d sent", sent)
+	}
+}
+
+func TestProcessDatasetsDeletesRecords(t *testing.T) {
+	maxRows = originalBatchRows
+
+	config := models.Config{
+		DatabaseConfig: &models.DatabaseConfig{
+			Driver: models.SQLiteDriver,
+			URL:    filepath.Join("models", "fixtures", "db.sqlite"),
+		},
+		Datasets: []models.Dataset{
+			{
+				Name:       "app.builds",
+				SQL:        "SELECT id, app_name FROM builds WHERE app_name != '' ORDER BY id LIMIT 2",
+				DeleteSQL:  "SELECT id FROM builds WHERE app_name = '' ORDER BY id",
+				UpdateType: models.Append,
+				UniqueBy:   []string{"id"},
+				Fields: []models.Field{
+					{Name: "ID", Type: models.NumberType},
+					{Name: "App", Type: models.StringType},
+				},
+			},
+		},
+	}
+
+	var reqs []string
+
+	gbWS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		reqs = append(reqs, fmt.Sprintf("%s %s %s", r.Method, r.URL.Path, strings.TrimSpace(string(b))))
+		fmt.Fprintf(w, `{}`)
+	}))
+	defer gbWS.Close()
+
+	gbHost = gbWS.URL
+
+	db, err := newDBConnection(config.DatabaseConfig.Driver, config.DatabaseConfig.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if processAllDatasets(&config, clients{"": NewClient("fakeKey")}, databases{"": db}, nil) != exitOK {
+		t.Fatal("Expected no errors processing datasets")
+	}
+
+	exp := []string{
+		`PUT /datasets/app.builds {"id":"app.builds","unique_by":["id"],"fields":{"app":{"type":"string","name":"App"},"id":{"type":"number","name":"ID"}}}`,
+		`POST /datasets/app.builds/data {"data":[{"app":"everdeen","id":1},{"app":"react","id":2}]}`,
+		`DELETE /datasets/app.builds/data {"data":[{"id":8},{"id":9}]}`,
+	}
+
+	if !reflect.DeepEqual(reqs, exp) {
+		t.Errorf("Expected requests\n%s\nbut got\n%s", strings.Join(exp, "\n"), strings.Join(reqs, "\n"))
+	}
+}
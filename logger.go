@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logLevel is how important a logged event is, events
+// below the logger's level aren't written
+type logLevel int
+
+const (
+	debugLevel logLevel = iota
+	infoLevel
+	warnLevel
+	errorLevel
+)
+
+var logLevelNames = []string{"debug", "info", "warn", "error"}
+
+func (l logLevel) String() string {
+	return logLevelNames[l]
+}
+
+const (
+	textLogFormat = "text"
+	jsonLogFormat = "json"
+)
+
+// fields hold the structured details of a logged event, such
+// as the dataset, phase, rows, duration_ms and error
+type fields map[string]interface{}
+
+// logger writes events either as their plain message or as a JSON object per
+// line holding the time, level and message followed by the sorted fields
+type logger struct {
+	mu    sync.Mutex
+	w     io.Writer
+	json  bool
+	level logLevel
+	now   func() time.Time
+}
+
+// logs is where the progress of updates and requests to Geckoboard are logged
+var logs = &logger{w: os.Stdout, level: infoLevel, now: time.Now}
+
+func newLogger(w io.Writer, format, level string) (*logger, error) {
+	l := &logger{w: w, now: time.Now}
+
+	switch format {
+	case textLogFormat:
+	case jsonLogFormat:
+		l.json = true
+	default:
+		return nil, fmt.Errorf(`"%s" is not a valid log format, it must be either %s or %s`,
+			format, textLogFormat, jsonLogFormat)
+	}
+
+	for i, name := range logLevelNames {
+		if strings.ToLower(level) == name {
+			l.level = logLevel(i)
+			return l, nil
+		}
+	}
+
+	return nil, fmt.Errorf(`"%s" is not a valid log level, it must be one of %s`,
+		level, strings.Join(logLevelNames, ", "))
+}
+
+func (l *logger) debug(msg string, f fields) { l.log(debugLevel, msg, f) }
+func (l *logger) info(msg string, f fields)  { l.log(infoLevel, msg, f) }
+func (l *logger) warn(msg string, f fields)  { l.log(warnLevel, msg, f) }
+func (l *logger) err(msg string, f fields)   { l.log(errorLevel, msg, f) }
+
+// blank separates groups of events with an empty line in the text format
+func (l *logger) blank() {
+	if !l.json {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		fmt.Fprintln(l.w, "")
+	}
+}
+
+func (l *logger) log(level logLevel, msg string, f fields) {
+	if level < l.level {
+		return
+	}
+
+	if !l.json {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		fmt.Fprintln(l.w, msg)
+		return
+	}
+
+	keys := make([]string, 0, len(f))
+	for k := range f {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	var b bytes.Buffer
+
+	writeLogField(&b, "time", l.now().UTC().Format(time.RFC3339Nano))
+	writeLogField(&b, "level", level.String())
+	writeLogField(&b, "msg", msg)
+
+	for _, k := range keys {
+		writeLogField(&b, k, f[k])
+	}
+
+	b.WriteString("}\n")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.w.Write(b.Bytes())
+}
+
+// writeLogField appends the key and value to the JSON object being
+// built in b, errors are written as their message
+func writeLogField(b *bytes.Buffer, key string, v interface{}) {
+	if err, ok := v.(error); ok {
+		v = err.Error()
+	}
+
+	val, err := json.Marshal(v)
+	if err != nil {
+		val, _ = json.Marshal(fmt.Sprint(v))
+	}
+
+	if b.Len() == 0 {
+		b.WriteByte('{')
+	} else {
+		b.WriteByte(',')
+	}
+
+	k, _ := json.Marshal(key)
+	b.Write(k)
+	b.WriteByte(':')
+	b.Write(val)
+}
+
+// logConfigErrors logs the errors found validating the config as a single
+// event, listing each of them on its own line in the text format
+func logConfigErrors(errs []string) {
+	logs.blank()
+	logs.err("There are errors in your config:\n - "+strings.Join(errs, "\n - "),
+		fields{"phase": "config", "errors": errs})
+	logs.blank()
+}
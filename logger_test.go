@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/geckoboard/sql-dataset/models"
+)
+
+func TestNewLogger(t *testing.T) {
+	testCases := []struct {
+		format string
+		level  string
+		json   bool
+		exp    logLevel
+		err    string
+	}{
+		{
+			format: "text",
+			level:  "info",
+			exp:    infoLevel,
+		},
+		{
+			format: "json",
+			level:  "DEBUG",
+			json:   true,
+			exp:    debugLevel,
+		},
+		{
+			format: "json",
+			level:  "error",
+			json:   true,
+			exp:    errorLevel,
+		},
+		{
+			format: "xml",
+			level:  "info",
+			err:    `"xml" is not a valid log format, it must be either text or json`,
+		},
+		{
+			format: "text",
+			level:  "verbose",
+			err:    `"verbose" is not a valid log level, it must be one of debug, info, warn, error`,
+		},
+	}
+
+	for i, tc := range testCases {
+		l, err := newLogger(&bytes.Buffer{}, tc.format, tc.level)
+
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("[%d] Expected error %q but got %v", i, tc.err, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("[%d] Expected no error but got %s", i, err)
+			continue
+		}
+
+		if l.json != tc.json || l.level != tc.exp {
+			t.Errorf("[%d] Expected json %t and level %s but got %t and %s", i, tc.json, tc.exp, l.json, l.level)
+		}
+	}
+}
+
+func TestLoggerFormats(t *testing.T) {
+	now := func() time.Time { return time.Date(2021, time.March, 10, 14, 23, 45, 0, time.UTC) }
+
+	var buf bytes.Buffer
+	l := &logger{w: &buf, json: true, level: infoLevel, now: now}
+
+	l.debug("Querying", fields{"dataset": "app.builds"})
+	l.info("Successfully updated", fields{"dataset": "app.builds", "phase": "done", "rows": 0, "duration_ms": int64(1520)})
+	l.err("Failed", fields{"dataset": "app.costs", "error": errors.New("Query failed")})
+
+	exp := `{"time":"2021-03-10T14:23:45Z","level":"info","msg":"Successfully updated","dataset":"app.builds","duration_ms":1520,"phase":"done","rows":0}
+{"time":"2021-03-10T14:23:45Z","level":"error","msg":"Failed","dataset":"app.costs","error":"Query failed"}
+`
+
+	if buf.String() != exp {
+		t.Errorf("Expected json logs\n%s\nbut got\n%s", exp, buf.String())
+	}
+
+	buf.Reset()
+	l = &logger{w: &buf, level: warnLevel, now: now}
+
+	l.info("Successfully updated", fields{"dataset": "app.builds"})
+	l.warn("Retrying", fields{"retry": 1})
+	l.blank()
+	l.err("Failed", nil)
+
+	exp = "Retrying\n\nFailed\n"
+
+	if buf.String() != exp {
+		t.Errorf("Expected text logs %q but got %q", exp, buf.String())
+	}
+}
+
+func TestLogConfigErrors(t *testing.T) {
+	now := func() time.Time { return time.Date(2021, time.March, 10, 14, 23, 45, 0, time.UTC) }
+	errs := []string{"No api key provided", "No datasets provided"}
+
+	defer func(l *logger) { logs = l }(logs)
+
+	var buf bytes.Buffer
+
+	logs = &logger{w: &buf, level: infoLevel, now: now}
+	logConfigErrors(errs)
+
+	exp := "\nThere are errors in your config:\n - No api key provided\n - No datasets provided\n\n"
+
+	if buf.String() != exp {
+		t.Errorf("Expected text logs %q but got %q", exp, buf.String())
+	}
+
+	buf.Reset()
+
+	logs = &logger{w: &buf, json: true, level: infoLevel, now: now}
+	logConfigErrors(errs)
+
+	exp = `{"time":"2021-03-10T14:23:45Z","level":"error","msg":"There are errors in your config:\n - No api key provided\n - No datasets provided",` +
+		`"errors":["No api key provided","No datasets provided"],"phase":"config"}` + "\n"
+
+	if buf.String() != exp {
+		t.Errorf("Expected json logs\n%s\nbut got\n%s", exp, buf.String())
+	}
+}
+
+func TestProcessAllDatasetsLogsJSON(t *testing.T) {
+	maxRows = originalBatchRows
+
+	var buf bytes.Buffer
+
+	defer func(l *logger) { logs = l }(logs)
+	logs = &logger{w: &buf, json: true, level: debugLevel, now: time.Now}
+
+	gbWS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/datasets/app.costs") {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":{"message":"Bad request"}}`)
+			return
+		}
+
+		fmt.Fprint(w, `{}`)
+	}))
+	defer gbWS.Close()
+
+	gbHost = gbWS.URL
+
+	db, err := newDBConnection(models.SQLiteDriver, filepath.Join("models", "fixtures", "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dsFields := []models.Field{{Name: "App", Type: models.StringType}}
+
+	config := models.Config{
+		DatabaseConfig: &models.DatabaseConfig{Driver: models.SQLiteDriver},
+		Datasets: []models.Dataset{
+			{Name: "app.builds", SQL: "SELECT app_name FROM builds LIMIT 3", UpdateType: models.Replace, Fields: dsFields},
+			{Name: "app.costs", SQL: "SELECT app_name FROM builds LIMIT 2", UpdateType: models.Replace, Fields: dsFields},
+		},
+	}
+
+	if code := processAllDatasets(&config, clients{"": NewClient("fakeKey")}, databases{"": db}, nil); code != exitAPI {
+		t.Errorf("Expected exit code %d but got %d", exitAPI, code)
+	}
+
+	var events []map[string]interface{}
+
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var ev map[string]interface{}
+
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			t.Fatalf("Expected every line to be JSON but got %q: %s", line, err)
+		}
+
+		events = append(events, ev)
+	}
+
+	has := func(level, dataset, phase string, rows float64, hasErr bool) bool {
+		for _, ev := range events {
+			if ev["level"] != level || ev["phase"] != phase {
+				continue
+			}
+
+			if dataset != "" && ev["dataset"] != dataset {
+				continue
+			}
+
+			if rows >= 0 && ev["rows"] != rows {
+				continue
+			}
+
+			if _, ok := ev["error"]; ok == hasErr {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	expected := []struct {
+		level   string
+		dataset string
+		phase   string
+		rows    float64
+		err     bool
+	}{
+		{"debug", "app.builds", "query", -1, false},
+		{"debug", "app.builds", "create", -1, false},
+		{"debug", "", "request", -1, false},
+		{"debug", "app.builds", "send", 3, false},
+		{"info", "app.builds", "done", 3, false},
+		{"debug", "", "request", -1, true},
+		{"error", "app.costs", "send", 2, true},
+		{"info", "app.builds", "summary", 3, false},
+		{"info", "app.costs", "summary", 2, true},
+		{"warn", "", "summary", -1, false},
+	}
+
+	for i, exp := range expected {
+		if !has(exp.level, exp.dataset, exp.phase, exp.rows, exp.err) {
+			t.Errorf("[%d] Expected a %s %s event for %q but got\n%s", i, exp.level, exp.phase, exp.dataset, buf.String())
+		}
+	}
+
+	for _, ev := range events {
+		if ev["phase"] == "done" || ev["phase"] == "summary" && ev["dataset"] != nil {
+			if _, ok := ev["duration_ms"].(float64); !ok {
+				t.Errorf("Expected a duration_ms in %v", ev)
+			}
+		}
+	}
+}
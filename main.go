@@ -2,21 +2,100 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
-	"github.com/geckoboard/sql-dataset/drivers"
 	"github.com/geckoboard/sql-dataset/models"
 )
 
+// maxDBConnections is the size of the database connection pool
+// and caps the number of datasets processed concurrently
+const maxDBConnections = 5
+
+// shutdownTimeout is how long in-flight updates are given to finish once
+// interrupted, this sits under the 30 second grace period most process
+// managers give before killing the process
+const shutdownTimeout = 25 * time.Second
+
+var errSkippedShutdown = errors.New("Skipped as SQL-Dataset is shutting down")
+
+// datasetResult records the outcome of processing a single dataset
+type datasetResult struct {
+	name     string
+	rows     int
+	deleted  int
+	started  time.Time
+	duration time.Duration
+	hash     string
+	err      error
+	kind     failureKind
+
+	// unchanged is set when the data wasn't sent as it
+	// was the same as the last successful update
+	unchanged bool
+}
+
+// runStats totals the dataset updates made while running on a schedule
+type runStats struct {
+	mu      sync.Mutex
+	updates int
+	failed  int
+	skipped int
+}
+
+func (rs *runStats) add(results []datasetResult) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	for _, r := range results {
+		switch r.err {
+		case nil:
+			rs.updates++
+		case errSkippedShutdown:
+			rs.skipped++
+		default:
+			rs.updates++
+			rs.failed++
+		}
+	}
+}
+
+func (rs *runStats) String() string {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	return fmt.Sprintf("Shut down after %d dataset updates, %d failed and %d skipped",
+		rs.updates, rs.failed, rs.skipped)
+}
+
 var (
 	configFile     = flag.String("config", "sql-dataset.yml", "Config file to load")
-	deleteDataset  = flag.String("delete-dataset", "", "Pass a dataset name you want to delete")
+	deleteDataset  = flag.String("delete-dataset", "", "Pass a comma separated list of dataset names or glob patterns matching configured datasets to delete")
+	assumeYes      = flag.Bool("yes", false, "Deletes datasets without asking for confirmation")
+	force          = flag.Bool("force", false, "The same as -yes")
+	account        = flag.String("account", "", "Geckoboard account to delete from when the dataset isn't in the config")
+	dryRun         = flag.Bool("dry-run", false, "Runs every query once and prints the requests which would be sent to Geckoboard without sending them")
+	dryRunOutput   = flag.String("dry-run-output", "", "File to write the -dry-run requests to instead of stdout")
+	preview        = flag.String("preview", "", "Pass a dataset name to print the first rows of its query as a table")
+	previewRows    = flag.Int("preview-rows", 10, "Number of rows shown by -preview")
+	genFields      = flag.String("generate-fields", "", "Pass a dataset name to print the fields inferred from its query as YAML")
+	showStatus     = flag.Bool("status", false, "Prints the outcome of the last run of each dataset from the state file")
+	showDatasets   = flag.Bool("list-datasets", false, "Lists the datasets in each Geckoboard account and whether they're in the config")
+	prune          = flag.Bool("prune", false, "Deletes the datasets in each Geckoboard account which aren't in the config")
+	logFormat      = flag.String("log-format", textLogFormat, "Format of the log output, either text or json")
+	minLogLevel    = flag.String("log-level", "info", "Lowest level of events logged, one of debug, info, warn or error")
 	displayVersion = flag.Bool("version", false, "Displays version info")
 	version        = ""
 	gitSHA         = ""
@@ -25,6 +104,14 @@ var (
 func main() {
 	flag.Parse()
 
+	l, err := newLogger(os.Stdout, *logFormat, *minLogLevel)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(exitUsage)
+	}
+
+	logs = l
+
 	if *displayVersion {
 		fmt.Printf("Version: %s\nGitSHA: %s\n", version, gitSHA)
 		os.Exit(0)
@@ -32,97 +119,510 @@ func main() {
 
 	config, err := models.LoadConfig(*configFile)
 	if err != nil {
-		log.Fatal(err)
+		logs.err(err.Error(), fields{"phase": "config", "error": err})
+		os.Exit(exitConfig)
 	}
 
 	if errs := config.Validate(); errs != nil {
-		fmt.Println("\nThere are errors in your config:")
+		logConfigErrors(errs)
+		os.Exit(exitConfig)
+	}
+
+	if *preview != "" {
+		if err := previewDataset(os.Stdout, *preview, *previewRows, config); err != nil {
+			exitWithError("preview", err)
+		}
+
+		os.Exit(0)
+	}
+
+	if *showStatus {
+		st, err := loadState(config)
+		if err != nil {
+			logs.err(fmt.Sprintf("Failed to load the state file: %s", err), fields{"phase": "state", "error": err})
+			os.Exit(1)
+		}
+
+		printStatus(os.Stdout, config, st)
+		os.Exit(0)
+	}
+
+	if *genFields != "" {
+		if err := generateFields(os.Stdout, *genFields, config); err != nil {
+			exitWithError("generate", err)
+		}
+
+		os.Exit(0)
+	}
+
+	cs := newClients(config)
 
-		for i, err := range errs {
-			fmt.Println(" -", err)
+	if *dryRun {
+		w := os.Stdout
 
-			if i == len(errs)-1 {
-				fmt.Println("")
+		if *dryRunOutput != "" {
+			if w, err = os.Create(*dryRunOutput); err != nil {
+				logs.err(err.Error(), fields{"phase": "config", "error": err})
+				os.Exit(1)
 			}
+
+			defer w.Close()
 		}
 
-		os.Exit(1)
+		cs.dryRun(w)
+	}
+
+	if *showDatasets || *prune {
+		if err := listDatasetsSwitch(*prune, config, cs); err != nil {
+			phase := "list"
+			if *prune {
+				phase = "delete"
+			}
+
+			exitWithError(phase, err)
+		}
+
+		os.Exit(0)
 	}
 
 	if *deleteDataset != "" {
-		if err := deleteDatasetSwitch(*deleteDataset, config); err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+		if err := deleteDatasetSwitch(*deleteDataset, config, cs); err != nil {
+			exitWithError("delete", err)
 		}
 
 		os.Exit(0)
 	}
 
-	// Build the connection string
-	dc := config.DatabaseConfig
-	b, err := drivers.NewConnStringBuilder(dc.Driver)
+	st, err := loadState(config)
 	if err != nil {
-		fmt.Println(err)
+		logs.err(fmt.Sprintf("Failed to load the state file: %s", err), fields{"phase": "state", "error": err})
 		os.Exit(1)
 	}
 
-	dsn, err := b.Build(dc)
+	// A dry run reads the state but doesn't record anything as sent
+	st.readOnly = *dryRun
 
+	dbs, err := openDatabases(config)
 	if err != nil {
-		fmt.Println("There was an error while trying to build "+
-			"your database connection string:", err)
-		os.Exit(1)
+		exitWithError("connect", err)
+	}
+
+	// A dry run only ever runs once, regardless of schedules
+	if *dryRun || config.RefreshTimeSec == 0 && !config.HasSchedules() {
+		code := processAllDatasets(config, cs, dbs, st)
+		dbs.Close()
+		os.Exit(code)
 	}
 
-	client := NewClient(config.GeckoboardAPIKey)
-	db, err := newDBConnection(dc.Driver, dsn)
+	os.Exit(runUntilInterrupted(config, cs, dbs, st))
+}
+
+// exitWithError logs the error a command failed with and exits with its
+// code, config and connection errors are logged with their own phase
+func exitWithError(phase string, err error) {
+	code := errorExitCode(err)
+
+	switch code {
+	case exitConfig:
+		phase = "config"
+	case exitConnection:
+		phase = "connect"
+	}
+
+	logs.err(err.Error(), fields{"phase": phase, "error": err})
+	os.Exit(code)
+}
+
+// runUntilInterrupted runs the datasets on their schedules until a SIGINT or
+// SIGTERM is received, at which point no new updates are started and those in
+// flight are given until the shutdown timeout to finish before they are
+// cancelled and the database pools are closed. The returned exit code is non
+// zero if the timeout was hit.
+func runUntilInterrupted(config *models.Config, cs clients, dbs databases, st *state) (exitCode int) {
+	// Stopping only prevents new updates starting, in-flight
+	// queries and requests are cancelled with ctx
+	stopCtx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	var stats runStats
+
+	// Each dataset runs alongside the others on its own
+	// schedule, so they share a pool to stay within the limit
+	pool := newWorkerPool(config, len(config.Datasets))
+
+	s, err := newScheduler(config, func(ds models.Dataset) {
+		results := processDatasets(ctx, stopCtx.Done(), pool, config, cs, dbs, st, []models.Dataset{ds})
+		stats.add(results)
+	})
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		logs.err(err.Error(), fields{"phase": "schedule", "error": err})
+		return 1
 	}
 
-	if config.RefreshTimeSec == 0 {
-		processAllDatasets(config, client, db)
-	} else {
-		fmt.Printf("Running every %d seconds, until interrupted.\n\n", config.RefreshTimeSec)
-		for {
-			processAllDatasets(config, client, db)
-			time.Sleep(time.Duration(config.RefreshTimeSec) * time.Second)
+	done := make(chan struct{})
+
+	go func() {
+		s.Run(stopCtx)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case sig := <-signals:
+		logs.blank()
+		logs.info(fmt.Sprintf("Received %s, waiting up to %s for in-flight updates to finish. "+
+			"Interrupt again to exit immediately.", sig, shutdownTimeout), fields{"phase": "shutdown"})
+		stop()
+
+		select {
+		case <-done:
+		case <-signals:
+			logs.warn("Exiting without waiting for in-flight updates", fields{"phase": "shutdown"})
+			exitCode = 1
+		case <-time.After(shutdownTimeout):
+			logs.warn("Timed out waiting for in-flight updates to finish", fields{"phase": "shutdown"})
+			exitCode = 1
 		}
 	}
+
+	cancel()
+	dbs.Close()
+	logs.info(stats.String(), fields{"phase": "shutdown"})
+
+	return exitCode
 }
 
-func processAllDatasets(config *models.Config, client *Client, db *sql.DB) (hasErrored bool) {
-	for _, ds := range config.Datasets {
-		datasetRecs, err := ds.BuildDataset(config.DatabaseConfig, db)
-		if err != nil {
-			printErrorMsg(ds.Name, err)
-			hasErrored = true
-			continue
+// processAllDatasets updates every dataset once, printing a table of the
+// results, and returns the exit code for the kind of failure if any failed
+func processAllDatasets(config *models.Config, cs clients, dbs databases, st *state) (exitCode int) {
+	results := processDatasets(context.Background(), nil, nil, config, cs, dbs, st, config.Datasets)
+
+	logResults(results)
+	printResultsSummary(results)
+
+	return resultsExitCode(results)
+}
+
+// workerPool holds a slot for each dataset which can be processed at once
+type workerPool chan struct{}
+
+func newWorkerPool(config *models.Config, datasets int) workerPool {
+	n := workerCount(config, datasets)
+	if n < 1 {
+		n = 1
+	}
+
+	return make(workerPool, n)
+}
+
+// processDatasets runs each dataset through a pool of workers bounded by
+// max_concurrency and the size of the database connection pool, the results
+// are returned in the same order as the datasets. A shared pool limits the
+// datasets processed at once across calls, when nil one is made for this
+// call. Once stop is closed no more datasets are started and those remaining
+// are marked as skipped.
+func processDatasets(ctx context.Context, stop <-chan struct{}, pool workerPool, config *models.Config, cs clients, dbs databases, st *state, datasets []models.Dataset) []datasetResult {
+	results := make([]datasetResult, len(datasets))
+	jobs := make(chan int)
+
+	if pool == nil {
+		pool = newWorkerPool(config, len(datasets))
+	}
+
+	var wg sync.WaitGroup
+
+	for w := 0; w < workerCount(config, len(datasets)); w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				select {
+				case pool <- struct{}{}:
+				case <-stop:
+					results[i] = datasetResult{name: datasets[i].Name, err: errSkippedShutdown}
+					continue
+				}
+
+				results[i] = processDataset(ctx, config, cs, dbs, st, datasets[i])
+				<-pool
+			}
+		}()
+	}
+
+	for i, ds := range datasets {
+		if !isClosed(stop) {
+			select {
+			case jobs <- i:
+				continue
+			case <-stop:
+			}
+		}
+
+		results[i] = datasetResult{name: ds.Name, err: errSkippedShutdown}
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func workerCount(config *models.Config, datasets int) int {
+	n := int(config.MaxConcurrency)
+
+	if n < 1 {
+		n = 1
+	}
+
+	// Any more workers than connections would just queue waiting on the pool
+	if n > maxDBConnections {
+		n = maxDBConnections
+	}
+
+	if n > datasets {
+		n = datasets
+	}
+
+	return n
+}
+
+// processDataset queries the database for a single dataset and
+// pushes the results to Geckoboard, reporting the outcome
+func processDataset(ctx context.Context, config *models.Config, cs clients, dbs databases, st *state, ds models.Dataset) (result datasetResult) {
+	result.name = ds.Name
+	result.started = time.Now()
+
+	defer func() {
+		result.duration = time.Since(result.started)
+
+		if result.err != nil {
+			printErrorMsg(result)
+		}
+
+		if err := st.recordRun(result); err != nil {
+			logs.warn(fmt.Sprintf("Failed to save the run of %s to the state file: %s", ds.Name, err),
+				fields{"dataset": ds.Name, "phase": "state", "error": err})
+		}
+	}()
+
+	client, err := cs.forDataset(config, ds)
+	if err != nil {
+		result.fail(failedConfig, err)
+		return result
+	}
+
+	name, dc, err := config.DatabaseFor(ds)
+	if err != nil {
+		result.fail(failedConfig, err)
+		return result
+	}
+
+	logs.debug(fmt.Sprintf("Querying \"%s\"", ds.Name), fields{"dataset": ds.Name, "phase": "query"})
+
+	// A replace is read in full before anything is sent so the dataset isn't
+	// left half replaced when the query fails, reading stops once it has more
+	// records than a dataset can hold. Appends are sent batch by batch as read.
+	size := maxRows
+	if ds.UpdateType == models.Replace {
+		size = 0
+	}
+
+	var (
+		created     bool
+		sendErr     error
+		stateErr    error
+		pending     models.DatasetRows
+		pendingLast string
+		batches     int
+		payload     = sha256.New()
+	)
+
+	// Incremental datasets only query rows after the last value sent
+	ds.LastValue = st.lastValue(ds.Name)
+	saved := ds.LastValue
+
+	// The last value is saved after each batch is sent, so a failure
+	// partway through doesn't send the earlier batches again next time
+	send := func(batch models.DatasetRows, lastValue string) error {
+		if !created {
+			logs.debug(fmt.Sprintf("Creating \"%s\"", ds.Name), fields{"dataset": ds.Name, "phase": "create"})
+
+			if err := findOrCreateDataset(ctx, client, &ds, st); err != nil {
+				return err
+			}
+
+			created = true
+		}
+
+		if err := client.SendAllData(ctx, &ds, batch); err != nil {
+			return err
+		}
+
+		logs.debug(fmt.Sprintf("Sent %d rows to \"%s\"", len(batch), ds.Name),
+			fields{"dataset": ds.Name, "phase": "send", "rows": len(batch)})
+
+		if !ds.IsIncremental() || lastValue == saved {
+			return nil
+		}
+
+		if err := st.setLastValue(ds.Name, lastValue); err != nil {
+			stateErr = fmt.Errorf("Failed to save the last value sent to the state file: %s", err)
+			return stateErr
 		}
 
-		err = client.FindOrCreateDataset(&ds)
+		saved = lastValue
+		return nil
+	}
+
+	// Each batch is held until the next is read, so that when the results
+	// fit in a single batch they can be skipped if they haven't changed
+	update := func() error {
+		result.rows, batches, pending, pendingLast = 0, 0, nil, ""
+		payload.Reset()
+
+		err := ds.StreamDataset(ctx, dc, dbs[name], size, func(batch models.DatasetRows, lastValue string) error {
+			result.rows += len(batch)
+			batches++
+
+			if err := hashRows(payload, batch); err != nil {
+				return err
+			}
+
+			if pending != nil {
+				if sendErr = send(pending, pendingLast); sendErr != nil {
+					return sendErr
+				}
+			}
+
+			pending, pendingLast = batch, lastValue
+			return nil
+		})
+
 		if err != nil {
-			printErrorMsg(ds.Name, err)
-			hasErrored = true
-			continue
+			return err
+		}
+
+		if err := hashSchema(payload, &ds); err != nil {
+			return err
 		}
 
-		err = client.SendAllData(&ds, datasetRecs)
+		result.hash = hex.EncodeToString(payload.Sum(nil))
+
+		if batches == 1 && st.unchanged(config.SkipUnchanged, ds.Name, result.hash, result.started) {
+			result.unchanged = true
+			logs.info(fmt.Sprintf("Skipped updating \"%s\" as its data is unchanged", ds.Name),
+				fields{"dataset": ds.Name, "phase": "skip", "rows": result.rows})
+			return nil
+		}
+
+		sendErr = send(pending, pendingLast)
+		return sendErr
+	}
+
+	err = update()
+
+	// A recreated incremental dataset is empty, so rather than only sending
+	// the rows after its last value it's queried again from the start
+	if err == errRecreatedIncremental {
+		logs.info(fmt.Sprintf("Sending all of \"%s\" again from the cursor_initial_value as it was recreated", ds.Name),
+			fields{"dataset": ds.Name, "phase": "create"})
+
+		ds.LastValue, saved = "", ""
+		err = update()
+	}
+
+	switch {
+	case err == nil:
+	case err == stateErr:
+		result.fail(failedOther, err)
+		return result
+	case err == sendErr:
+		result.fail(failedAPI, err)
+		return result
+	default:
+		result.fail(queryFailure(err), err)
+		return result
+	}
+
+	// Records removed from the source are deleted even when the
+	// data is unchanged, as they may not be in the dataset query
+	if ds.HasDeletions() {
+		logs.debug(fmt.Sprintf("Querying the records to delete from \"%s\"", ds.Name),
+			fields{"dataset": ds.Name, "phase": "delete"})
+
+		deletions, err := ds.BuildDeletions(ctx, dc, dbs[name])
 		if err != nil {
-			printErrorMsg(ds.Name, err)
-			hasErrored = true
-			continue
+			result.fail(queryFailure(err), fmt.Errorf("Failed to delete records: %s", err))
+			return result
+		}
+
+		if len(deletions) > 0 {
+			if err := client.DeleteRecords(ctx, &ds, deletions); err != nil {
+				result.fail(failedAPI, fmt.Errorf("Failed to delete records: %s", err))
+				return result
+			}
+		}
+
+		if result.deleted = len(deletions); result.deleted > 0 {
+			logs.info(fmt.Sprintf("Deleted %d records from \"%s\"", result.deleted, ds.Name),
+				fields{"dataset": ds.Name, "phase": "delete", "rows": result.deleted})
 		}
+	}
+
+	if result.unchanged {
+		return result
+	}
 
-		fmt.Printf("Successfully updated \"%s\"\n", ds.Name)
+	logs.info(fmt.Sprintf("Successfully updated \"%s\"", ds.Name), fields{
+		"dataset":     ds.Name,
+		"phase":       "done",
+		"rows":        result.rows,
+		"duration_ms": time.Since(result.started).Milliseconds(),
+	})
+
+	return result
+}
+
+func printResultsSummary(results []datasetResult) {
+	var failed int
+
+	for _, r := range results {
+		if r.err != nil {
+			failed++
+		}
 	}
 
-	return hasErrored
+	if failed > 0 {
+		logs.warn(fmt.Sprintf("%d of %d datasets failed to update", failed, len(results)),
+			fields{"phase": "summary", "failed": failed, "total": len(results)})
+	}
 }
 
-func printErrorMsg(name string, err error) {
-	fmt.Printf("There was an error while trying to update %s: %s\n", name, err)
+func printErrorMsg(r datasetResult) {
+	logs.err(fmt.Sprintf("There was an error while trying to update %s: %s", r.name, r.err), fields{
+		"dataset":     r.name,
+		"phase":       r.kind.phase(),
+		"rows":        r.rows,
+		"duration_ms": r.duration.Milliseconds(),
+		"error":       r.err,
+	})
 }
 
 func newDBConnection(driver, url string) (*sql.DB, error) {
@@ -131,38 +631,132 @@ func newDBConnection(driver, url string) (*sql.DB, error) {
 	err := pool.Ping()
 
 	if err != nil {
-		return nil, fmt.Errorf("Failed to open database connection. "+
-			"This is the error received: %s", err)
+		return nil, &models.ConnectionError{Err: fmt.Errorf("Failed to open database connection. "+
+			"This is the error received: %s", err)}
 	}
 
-	pool.SetMaxOpenConns(5)
+	pool.SetMaxOpenConns(maxDBConnections)
 
 	return pool, err
 }
 
-func deleteDatasetSwitch(name string, config *models.Config) error {
-	fmt.Printf("Delete dataset %q (y/N): ", name)
+func deleteDatasetSwitch(names string, config *models.Config, cs clients) error {
+	list, err := datasetsToDelete(names, config, cs)
+	if err != nil {
+		return err
+	}
 
-	v, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if len(list) == 0 {
+		return errors.New("No dataset names provided to delete")
+	}
+
+	if !*assumeYes && !*force {
+		quoted := make([]string, len(list))
+		for i, ds := range list {
+			quoted[i] = strconv.Quote(ds.name)
+		}
+
+		ok, err := confirm(fmt.Sprintf("Delete dataset %s", strings.Join(quoted, ", ")))
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			fmt.Println("Cancelled action")
+			return nil
+		}
+	}
+
+	st, err := loadState(config)
+	if err != nil {
+		return fmt.Errorf("Failed to load the state file: %s", err)
+	}
+
+	st.readOnly = *dryRun
+
+	return deletionError(deleteDatasets(context.Background(), config, cs, st, list), len(list))
+}
+
+// deletionError reports how many of the datasets failed to delete
+func deletionError(failed, total int) error {
+	if failed == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%d of the %d datasets failed to delete", failed, total)
+}
+
+// listDatasetsSwitch prints the datasets in each Geckoboard account and
+// when pruning deletes those not in the config once confirmed
+func listDatasetsSwitch(pruning bool, config *models.Config, cs clients) error {
+	ctx := context.Background()
+
+	list, err := listDatasets(ctx, config, cs)
 	if err != nil {
 		return err
 	}
 
+	if !pruning {
+		printDatasetList(os.Stdout, list)
+		return nil
+	}
+
+	list = unconfiguredDatasets(list)
+
+	if len(list) == 0 {
+		logs.info("There are no datasets to prune", fields{"phase": "delete"})
+		return nil
+	}
+
+	printDatasetList(os.Stdout, list)
+
+	if !*assumeYes && !*force {
+		ok, err := confirm(fmt.Sprintf("\nDelete these %d datasets", len(list)))
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			fmt.Println("Cancelled action")
+			return nil
+		}
+	}
+
+	st, err := loadState(config)
+	if err != nil {
+		return fmt.Errorf("Failed to load the state file: %s", err)
+	}
+
+	st.readOnly = *dryRun
+
+	return deletionError(deleteDatasets(ctx, config, cs, st, list), len(list))
+}
+
+// confirm asks the question on stdout and
+// reports whether it was answered with y
+func confirm(question string) (bool, error) {
+	fmt.Printf("%s (y/N): ", question)
+
+	v, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false, err
+	}
+
 	// Remove newline and carriage return for windows
 	v = strings.TrimRight(v, "\n")
 	v = strings.TrimRight(v, "\r")
 
-	switch strings.ToLower(v) {
-	case "y":
-		client := NewClient(config.GeckoboardAPIKey)
-		if err := client.DeleteDataset(*deleteDataset); err != nil {
-			return err
-		}
+	return strings.ToLower(v) == "y", nil
+}
 
-		fmt.Println("Dataset deleted successfully")
-	default:
-		fmt.Println("Cancelled action")
+// datasetToDelete returns the configured dataset with the name so it is
+// deleted from its own account, otherwise one in the -account flag account
+func datasetToDelete(name string, config *models.Config) models.Dataset {
+	for _, ds := range config.Datasets {
+		if ds.Name == name {
+			return ds
+		}
 	}
 
-	return nil
+	return models.Dataset{Name: name, Account: *account}
 }
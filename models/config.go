@@ -6,6 +6,8 @@ import (
 	"io/ioutil"
 	"os"
 	"regexp"
+	"sort"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
@@ -23,10 +25,47 @@ var (
 )
 
 type Config struct {
-	GeckoboardAPIKey string          `yaml:"geckoboard_api_key"`
-	DatabaseConfig   *DatabaseConfig `yaml:"database"`
-	RefreshTimeSec   uint16          `yaml:"refresh_time_sec"`
-	Datasets         []Dataset       `yaml:"datasets"`
+	GeckoboardAPIKey   string                        `yaml:"geckoboard_api_key"`
+	GeckoboardAccounts map[string]*GeckoboardAccount `yaml:"geckoboard_accounts"`
+	DatabaseConfig     *DatabaseConfig               `yaml:"database"`
+	Databases          map[string]*DatabaseConfig    `yaml:"databases"`
+	RefreshTimeSec     uint16                        `yaml:"refresh_time_sec"`
+	MaxConcurrency     uint8                         `yaml:"max_concurrency"`
+	Retries            *RetryConfig                  `yaml:"retries"`
+	RateLimit          *RateLimitConfig              `yaml:"rate_limit"`
+	StateFile          string                        `yaml:"state_file"`
+	SkipUnchanged      *SkipUnchangedConfig          `yaml:"skip_unchanged"`
+	Datasets           []Dataset                     `yaml:"datasets"`
+}
+
+// GeckoboardAccount holds the API key for an additional
+// Geckoboard account which datasets can be pushed to
+type GeckoboardAccount struct {
+	APIKey string `yaml:"api_key"`
+}
+
+// RetryConfig controls retrying requests to Geckoboard which fail with
+// a network error or a 5xx or 429 response, backing off exponentially
+type RetryConfig struct {
+	MaxRetries     uint8         `yaml:"max_retries"`
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+}
+
+// SkipUnchangedConfig skips sending a dataset when its data is the same
+// as the last successful update, unless it was sent longer than the max
+// interval ago. A zero max interval skips unchanged data indefinitely.
+type SkipUnchangedConfig struct {
+	MaxInterval time.Duration `yaml:"max_interval"`
+}
+
+// RateLimitConfig caps the rate of requests made to each Geckoboard
+// account, given either per second or per minute. Burst allows that
+// many requests to be made at once before the rate applies.
+type RateLimitConfig struct {
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+	RequestsPerMinute float64 `yaml:"requests_per_minute"`
+	Burst             uint16  `yaml:"burst"`
 }
 
 // DatabaseConfig holds the db type, url
@@ -42,6 +81,9 @@ type DatabaseConfig struct {
 	Password  string            `yaml:"password"`
 	TLSConfig *TLSConfig        `yaml:"tls_config"`
 	Params    map[string]string `yaml:"params"`
+
+	// QueryTimeout applies to every dataset query unless overridden
+	QueryTimeout time.Duration `yaml:"query_timeout"`
 }
 
 type TLSConfig struct {
@@ -72,27 +114,159 @@ func LoadConfig(filepath string) (config *Config, err error) {
 }
 
 func (c Config) Validate() (errors []string) {
-	if c.GeckoboardAPIKey == "" {
+	if c.GeckoboardAPIKey == "" && len(c.GeckoboardAccounts) == 0 {
 		errors = append(errors, errMissingAPIKey)
 	}
 
-	if c.DatabaseConfig == nil {
+	for _, name := range c.AccountNames() {
+		if acc := c.GeckoboardAccounts[name]; acc == nil || acc.APIKey == "" {
+			errors = append(errors, fmt.Sprintf(errNamedAccount, name, errMissingAPIKey))
+		}
+	}
+
+	if c.DatabaseConfig == nil && len(c.Databases) == 0 {
 		errors = append(errors, errMissingDBConfig)
-	} else {
+	}
+
+	if c.DatabaseConfig != nil {
 		errors = append(errors, c.DatabaseConfig.Validate()...)
 	}
 
+	for _, name := range c.DatabaseNames() {
+		dc := c.Databases[name]
+
+		if dc == nil {
+			errors = append(errors, fmt.Sprintf(errNamedDatabase, name, errMissingDBConfig))
+			continue
+		}
+
+		for _, err := range dc.Validate() {
+			errors = append(errors, fmt.Sprintf(errNamedDatabase, name, err))
+		}
+	}
+
+	if c.Retries != nil {
+		errors = append(errors, c.Retries.Validate()...)
+	}
+
+	if c.RateLimit != nil {
+		errors = append(errors, c.RateLimit.Validate()...)
+	}
+
+	if c.SkipUnchanged != nil && c.SkipUnchanged.MaxInterval < 0 {
+		errors = append(errors, fmt.Sprintf(errInvalidMaxInterval, c.SkipUnchanged.MaxInterval))
+	}
+
 	if len(c.Datasets) == 0 {
 		errors = append(errors, errNoDatasets)
 	}
 
 	for _, ds := range c.Datasets {
 		errors = append(errors, ds.Validate()...)
+
+		if _, _, err := c.APIKeyFor(ds); err != nil {
+			errors = append(errors, err.Error())
+		}
+
+		if c.DatabaseConfig != nil || len(c.Databases) > 0 {
+			if _, _, err := c.DatabaseFor(ds); err != nil {
+				errors = append(errors, err.Error())
+			}
+		}
 	}
 
 	return errors
 }
 
+// AccountNames returns the names of the Geckoboard
+// accounts configured in alphabetical order
+func (c Config) AccountNames() []string {
+	var names []string
+
+	for name := range c.GeckoboardAccounts {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// APIKeyFor returns the Geckoboard API key a dataset is pushed with along
+// with the account name. Datasets without an account use the
+// geckoboard_api_key, or when that is absent the only configured account.
+// The name is empty for the geckoboard_api_key.
+func (c Config) APIKeyFor(ds Dataset) (string, string, error) {
+	if ds.Account != "" {
+		acc, ok := c.GeckoboardAccounts[ds.Account]
+		if !ok || acc == nil {
+			return "", "", fmt.Errorf(errUnknownAccount, ds.Account, ds.Name)
+		}
+
+		return ds.Account, acc.APIKey, nil
+	}
+
+	if c.GeckoboardAPIKey != "" || len(c.GeckoboardAccounts) == 0 {
+		return "", c.GeckoboardAPIKey, nil
+	}
+
+	if len(c.GeckoboardAccounts) == 1 {
+		name := c.AccountNames()[0]
+		return c.APIKeyFor(Dataset{Name: ds.Name, Account: name})
+	}
+
+	return "", "", fmt.Errorf(errMissingDatasetAccount, ds.Name)
+}
+
+// DatabaseNames returns the names of the databases
+// configured under databases in alphabetical order
+func (c Config) DatabaseNames() []string {
+	var names []string
+
+	for name := range c.Databases {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// DatabaseFor returns the database a dataset queries along with its name.
+// Datasets without a database reference use the database config, or when
+// that is absent the only entry in databases. The name is empty for the
+// database config.
+func (c Config) DatabaseFor(ds Dataset) (string, *DatabaseConfig, error) {
+	if ds.Database != "" {
+		dc, ok := c.Databases[ds.Database]
+		if !ok || dc == nil {
+			return "", nil, fmt.Errorf(errUnknownDatabase, ds.Database, ds.Name)
+		}
+
+		return ds.Database, dc, nil
+	}
+
+	if c.DatabaseConfig != nil {
+		return "", c.DatabaseConfig, nil
+	}
+
+	if len(c.Databases) == 1 {
+		name := c.DatabaseNames()[0]
+		return name, c.Databases[name], nil
+	}
+
+	return "", nil, fmt.Errorf(errMissingDatasetDatabase, ds.Name)
+}
+
+// HasSchedules reports whether any dataset sets its own refresh schedule
+func (c Config) HasSchedules() bool {
+	for _, ds := range c.Datasets {
+		if ds.Schedule != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (dc DatabaseConfig) Validate() (errors []string) {
 	if dc.Driver == "" {
 		errors = append(errors, errMissingDBDriver)
@@ -111,23 +285,66 @@ func (dc DatabaseConfig) Validate() (errors []string) {
 		}
 	}
 
+	if dc.QueryTimeout < 0 {
+		errors = append(errors, fmt.Sprintf(errInvalidQueryTimeout, dc.QueryTimeout))
+	}
+
+	return errors
+}
+
+func (rc RetryConfig) Validate() (errors []string) {
+	if rc.InitialBackoff < 0 || rc.MaxBackoff < 0 {
+		errors = append(errors, errInvalidBackoff)
+	}
+
+	if rc.MaxBackoff > 0 && rc.InitialBackoff > rc.MaxBackoff {
+		errors = append(errors, fmt.Sprintf(errInitialBackoffTooLarge, rc.InitialBackoff, rc.MaxBackoff))
+	}
+
+	return errors
+}
+
+func (rl RateLimitConfig) Validate() (errors []string) {
+	switch {
+	case rl.RequestsPerSecond < 0 || rl.RequestsPerMinute < 0:
+		errors = append(errors, errInvalidRateLimit)
+	case rl.RequestsPerSecond > 0 && rl.RequestsPerMinute > 0:
+		errors = append(errors, errRateLimitBothSet)
+	case rl.RequestsPerSecond == 0 && rl.RequestsPerMinute == 0:
+		errors = append(errors, errMissingRateLimit)
+	}
+
 	return errors
 }
 
 func (c *Config) replaceSupportedInterpolatedValues() {
 	c.GeckoboardAPIKey = convertEnvToValue(c.GeckoboardAPIKey)
 
+	for _, acc := range c.GeckoboardAccounts {
+		if acc != nil {
+			acc.APIKey = convertEnvToValue(acc.APIKey)
+		}
+	}
+
 	if c.DatabaseConfig != nil {
-		dc := c.DatabaseConfig
+		c.DatabaseConfig.replaceSupportedInterpolatedValues()
+	}
 
-		dc.Username = convertEnvToValue(dc.Username)
-		dc.Password = convertEnvToValue(dc.Password)
-		dc.Host = convertEnvToValue(dc.Host)
-		dc.Database = convertEnvToValue(dc.Database)
-		dc.Port = convertEnvToValue(dc.Port)
+	for _, dc := range c.Databases {
+		if dc != nil {
+			dc.replaceSupportedInterpolatedValues()
+		}
 	}
 }
 
+func (dc *DatabaseConfig) replaceSupportedInterpolatedValues() {
+	dc.Username = convertEnvToValue(dc.Username)
+	dc.Password = convertEnvToValue(dc.Password)
+	dc.Host = convertEnvToValue(dc.Host)
+	dc.Database = convertEnvToValue(dc.Database)
+	dc.Port = convertEnvToValue(dc.Port)
+}
+
 func convertEnvToValue(value string) string {
 	if value == "" {
 		return ""
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestValidate(t *testing.T) {
@@ -154,6 +155,200 @@ func TestValidate(t *testing.T) {
 				fmt.Sprintf(errInvalidDatasetUpdateType, "wrong"),
 			},
 		},
+		{
+			Config{
+				GeckoboardAPIKey: "1234-12345",
+				DatabaseConfig: &DatabaseConfig{
+					Driver:       MySQLDriver,
+					URL:          "mysql://localhost/testdb",
+					QueryTimeout: -time.Second,
+				},
+				Datasets: []Dataset{
+					{
+						Name:         "users.count",
+						UpdateType:   Replace,
+						SQL:          "fake sql",
+						QueryTimeout: -time.Minute,
+						Fields:       []Field{{Name: "count", Type: "number"}},
+					},
+				},
+			},
+			[]string{
+				fmt.Sprintf(errInvalidQueryTimeout, "-1s"),
+				fmt.Sprintf(errInvalidQueryTimeout, "-1m0s"),
+			},
+		},
+		{
+			Config{
+				GeckoboardAPIKey: "1234-12345",
+				Databases: map[string]*DatabaseConfig{
+					"product": {Driver: PostgresDriver},
+					"finance": {Driver: MSSQLDriver},
+				},
+				Datasets: []Dataset{
+					{
+						Name:       "users.count",
+						UpdateType: Replace,
+						SQL:        "SELECT count(*) FROM users",
+						Database:   "product",
+						Fields:     []Field{{Name: "count", Type: "number"}},
+					},
+					{
+						Name:       "invoices.count",
+						UpdateType: Replace,
+						SQL:        "SELECT count(*) FROM invoices",
+						Database:   "finance",
+						Fields:     []Field{{Name: "count", Type: "number"}},
+					},
+				},
+			},
+			nil,
+		},
+		{
+			Config{
+				GeckoboardAPIKey: "1234-12345",
+				Databases: map[string]*DatabaseConfig{
+					"product": {Driver: PostgresDriver},
+					"finance": {Driver: "pear"},
+					"empty":   nil,
+				},
+				Datasets: []Dataset{
+					{
+						Name:       "users.count",
+						UpdateType: Replace,
+						SQL:        "SELECT count(*) FROM users",
+						Fields:     []Field{{Name: "count", Type: "number"}},
+					},
+					{
+						Name:       "invoices.count",
+						UpdateType: Replace,
+						SQL:        "SELECT count(*) FROM invoices",
+						Database:   "accounts",
+						Fields:     []Field{{Name: "count", Type: "number"}},
+					},
+				},
+			},
+			[]string{
+				fmt.Sprintf(errNamedDatabase, "empty", errMissingDBConfig),
+				fmt.Sprintf(errNamedDatabase, "finance", fmt.Sprintf(errDriverNotSupported, "pear", SupportedDrivers)),
+				fmt.Sprintf(errMissingDatasetDatabase, "users.count"),
+				fmt.Sprintf(errUnknownDatabase, "accounts", "invoices.count"),
+			},
+		},
+		{
+			Config{
+				GeckoboardAccounts: map[string]*GeckoboardAccount{
+					"agency":   {APIKey: "1234"},
+					"internal": {},
+				},
+				DatabaseConfig: &DatabaseConfig{Driver: PostgresDriver},
+				Datasets: []Dataset{
+					{
+						Name:       "users.count",
+						UpdateType: Replace,
+						SQL:        "SELECT count(*) FROM users",
+						Fields:     []Field{{Name: "count", Type: "number"}},
+					},
+					{
+						Name:       "invoices.count",
+						UpdateType: Replace,
+						SQL:        "SELECT count(*) FROM invoices",
+						Account:    "agency",
+						Fields:     []Field{{Name: "count", Type: "number"}},
+					},
+				},
+			},
+			[]string{
+				fmt.Sprintf(errNamedAccount, "internal", errMissingAPIKey),
+				fmt.Sprintf(errMissingDatasetAccount, "users.count"),
+			},
+		},
+		{
+			Config{
+				GeckoboardAPIKey: "1234-12345",
+				DatabaseConfig:   &DatabaseConfig{Driver: PostgresDriver},
+				Retries: &RetryConfig{
+					MaxRetries:     3,
+					InitialBackoff: time.Minute,
+					MaxBackoff:     time.Second,
+				},
+				Datasets: []Dataset{
+					{
+						Name:       "users.count",
+						UpdateType: Replace,
+						SQL:        "SELECT count(*) FROM users",
+						Fields:     []Field{{Name: "count", Type: "number"}},
+					},
+				},
+			},
+			[]string{
+				fmt.Sprintf(errInitialBackoffTooLarge, "1m0s", "1s"),
+			},
+		},
+		{
+			Config{
+				GeckoboardAPIKey: "1234-12345",
+				DatabaseConfig:   &DatabaseConfig{Driver: PostgresDriver},
+				Retries:          &RetryConfig{InitialBackoff: -time.Second},
+				Datasets: []Dataset{
+					{
+						Name:       "users.count",
+						UpdateType: Replace,
+						SQL:        "SELECT count(*) FROM users",
+						Fields:     []Field{{Name: "count", Type: "number"}},
+					},
+				},
+			},
+			[]string{errInvalidBackoff},
+		},
+		{
+			Config{
+				GeckoboardAPIKey: "1234-12345",
+				DatabaseConfig:   &DatabaseConfig{Driver: PostgresDriver},
+				RateLimit:        &RateLimitConfig{RequestsPerSecond: 2, RequestsPerMinute: 60},
+				Datasets: []Dataset{
+					{
+						Name:       "users.count",
+						UpdateType: Replace,
+						SQL:        "SELECT count(*) FROM users",
+						Fields:     []Field{{Name: "count", Type: "number"}},
+					},
+				},
+			},
+			[]string{errRateLimitBothSet},
+		},
+		{
+			Config{
+				GeckoboardAPIKey: "1234-12345",
+				DatabaseConfig:   &DatabaseConfig{Driver: PostgresDriver},
+				RateLimit:        &RateLimitConfig{Burst: 5},
+				Datasets: []Dataset{
+					{
+						Name:       "users.count",
+						UpdateType: Replace,
+						SQL:        "SELECT count(*) FROM users",
+						Fields:     []Field{{Name: "count", Type: "number"}},
+					},
+				},
+			},
+			[]string{errMissingRateLimit},
+		},
+		{
+			Config{
+				GeckoboardAPIKey: "1234-12345",
+				DatabaseConfig:   &DatabaseConfig{Driver: PostgresDriver},
+				SkipUnchanged:    &SkipUnchangedConfig{MaxInterval: -time.Hour},
+				Datasets: []Dataset{
+					{
+						Name:       "users.count",
+						UpdateType: Replace,
+						SQL:        "SELECT count(*) FROM users",
+						Fields:     []Field{{Name: "count", Type: "number"}},
+					},
+				},
+			},
+			[]string{fmt.Sprintf(errInvalidMaxInterval, -time.Hour)},
+		},
 	}
 
 	for i, tc := range testCases {
@@ -177,6 +372,148 @@ func TestValidate(t *testing.T) {
 	}
 }
 
+func TestDatabaseFor(t *testing.T) {
+	defaultDB := &DatabaseConfig{Driver: MySQLDriver}
+	productDB := &DatabaseConfig{Driver: PostgresDriver}
+	financeDB := &DatabaseConfig{Driver: MSSQLDriver}
+
+	testCases := []struct {
+		config  Config
+		dataset Dataset
+		name    string
+		db      *DatabaseConfig
+		err     string
+	}{
+		{
+			config:  Config{DatabaseConfig: defaultDB},
+			dataset: Dataset{Name: "users.count"},
+			db:      defaultDB,
+		},
+		{
+			config: Config{
+				DatabaseConfig: defaultDB,
+				Databases:      map[string]*DatabaseConfig{"product": productDB},
+			},
+			dataset: Dataset{Name: "users.count", Database: "product"},
+			name:    "product",
+			db:      productDB,
+		},
+		{
+			// The only named database is used without a reference
+			config: Config{
+				Databases: map[string]*DatabaseConfig{"product": productDB},
+			},
+			dataset: Dataset{Name: "users.count"},
+			name:    "product",
+			db:      productDB,
+		},
+		{
+			config: Config{
+				Databases: map[string]*DatabaseConfig{"product": productDB, "finance": financeDB},
+			},
+			dataset: Dataset{Name: "users.count"},
+			err:     fmt.Sprintf(errMissingDatasetDatabase, "users.count"),
+		},
+		{
+			config: Config{
+				DatabaseConfig: defaultDB,
+				Databases:      map[string]*DatabaseConfig{"product": productDB},
+			},
+			dataset: Dataset{Name: "users.count", Database: "finance"},
+			err:     fmt.Sprintf(errUnknownDatabase, "finance", "users.count"),
+		},
+	}
+
+	for i, tc := range testCases {
+		name, db, err := tc.config.DatabaseFor(tc.dataset)
+
+		if tc.err == "" && err != nil {
+			t.Errorf("[%d] Expected no error but got %s", i, err)
+		}
+
+		if err != nil && tc.err != err.Error() {
+			t.Errorf("[%d] Expected error %s but got %s", i, tc.err, err)
+		}
+
+		if name != tc.name {
+			t.Errorf("[%d] Expected database name %q but got %q", i, tc.name, name)
+		}
+
+		if db != tc.db {
+			t.Errorf("[%d] Expected database %#v but got %#v", i, tc.db, db)
+		}
+	}
+}
+
+func TestAPIKeyFor(t *testing.T) {
+	testCases := []struct {
+		config  Config
+		dataset Dataset
+		name    string
+		apiKey  string
+		err     string
+	}{
+		{
+			config:  Config{GeckoboardAPIKey: "default"},
+			dataset: Dataset{Name: "users.count"},
+			apiKey:  "default",
+		},
+		{
+			config: Config{
+				GeckoboardAPIKey:   "default",
+				GeckoboardAccounts: map[string]*GeckoboardAccount{"agency": {APIKey: "agency"}},
+			},
+			dataset: Dataset{Name: "users.count", Account: "agency"},
+			name:    "agency",
+			apiKey:  "agency",
+		},
+		{
+			// The only account is used without a reference
+			config: Config{
+				GeckoboardAccounts: map[string]*GeckoboardAccount{"agency": {APIKey: "agency"}},
+			},
+			dataset: Dataset{Name: "users.count"},
+			name:    "agency",
+			apiKey:  "agency",
+		},
+		{
+			config: Config{
+				GeckoboardAccounts: map[string]*GeckoboardAccount{
+					"agency":   {APIKey: "agency"},
+					"internal": {APIKey: "internal"},
+				},
+			},
+			dataset: Dataset{Name: "users.count"},
+			err:     fmt.Sprintf(errMissingDatasetAccount, "users.count"),
+		},
+		{
+			config:  Config{GeckoboardAPIKey: "default"},
+			dataset: Dataset{Name: "users.count", Account: "agency"},
+			err:     fmt.Sprintf(errUnknownAccount, "agency", "users.count"),
+		},
+	}
+
+	for i, tc := range testCases {
+		name, apiKey, err := tc.config.APIKeyFor(tc.dataset)
+
+		if tc.err == "" && err != nil {
+			t.Errorf("[%d] Expected no error but got %s", i, err)
+		}
+
+		if err != nil && tc.err != err.Error() {
+			t.Errorf("[%d] Expected error %s but got %s", i, tc.err, err)
+		}
+
+		if name != tc.name {
+			t.Errorf("[%d] Expected account name %q but got %q", i, tc.name, name)
+		}
+
+		if apiKey != tc.apiKey {
+			t.Errorf("[%d] Expected api key %q but got %q", i, tc.apiKey, apiKey)
+		}
+	}
+}
+
 func TestLoadConfig(t *testing.T) {
 	testCases := []struct {
 		in     string
@@ -245,13 +582,15 @@ func TestLoadConfig(t *testing.T) {
 						CAFile:  "path/cert.pem",
 						SSLMode: "verify-full",
 					},
+					QueryTimeout: 30 * time.Second,
 				},
 				RefreshTimeSec: 60,
 				Datasets: []Dataset{
 					{
-						Name:       "active.users.by.org.plan",
-						UpdateType: Replace,
-						SQL:        "SELECT o.plan_type, count(*) user_count FROM users u, organisation o where o.user_id = u.id AND o.plan_type <> 'trial' order by user_count DESC limit 10",
+						Name:         "active.users.by.org.plan",
+						UpdateType:   Replace,
+						QueryTimeout: 2 * time.Minute,
+						SQL:          "SELECT o.plan_type, count(*) user_count FROM users u, organisation o where o.user_id = u.id AND o.plan_type <> 'trial' order by user_count DESC limit 10",
 						Fields: []Field{
 							{Name: "count", Type: NumberType, Optional: true},
 							{Name: "org", Type: StringType},
@@ -262,6 +601,87 @@ func TestLoadConfig(t *testing.T) {
 			},
 			"",
 		},
+		{
+			filepath.Join("fixtures", "valid_config_databases.yml"),
+			map[string]string{
+				"TEST_FINANCE_PASS": "s3cr3t",
+			},
+			&Config{
+				GeckoboardAPIKey: "1234dsfd21322",
+				Databases: map[string]*DatabaseConfig{
+					"product": {
+						Driver:   PostgresDriver,
+						Host:     "product-host",
+						Database: "product",
+						Username: "reader",
+					},
+					"finance": {
+						Driver:   MSSQLDriver,
+						Host:     "finance-host",
+						Database: "finance",
+						Username: "sa",
+						Password: "s3cr3t",
+					},
+				},
+				Datasets: []Dataset{
+					{
+						Name:       "users.count",
+						UpdateType: Replace,
+						SQL:        "SELECT count(*) FROM users",
+						Database:   "product",
+						Fields: []Field{
+							{Name: "count", Type: NumberType},
+						},
+					},
+					{
+						Name:       "invoices.count",
+						UpdateType: Replace,
+						SQL:        "SELECT count(*) FROM invoices",
+						Database:   "finance",
+						Fields: []Field{
+							{Name: "count", Type: NumberType},
+						},
+					},
+				},
+			},
+			"",
+		},
+		{
+			filepath.Join("fixtures", "valid_config_accounts.yml"),
+			map[string]string{
+				"TEST_AGENCY_API_KEY": "agency123",
+			},
+			&Config{
+				GeckoboardAPIKey: "1234dsfd21322",
+				GeckoboardAccounts: map[string]*GeckoboardAccount{
+					"agency": {APIKey: "agency123"},
+				},
+				DatabaseConfig: &DatabaseConfig{
+					Driver:   PostgresDriver,
+					Database: "someDB",
+				},
+				Datasets: []Dataset{
+					{
+						Name:       "users.count",
+						UpdateType: Replace,
+						SQL:        "SELECT count(*) FROM users",
+						Fields: []Field{
+							{Name: "count", Type: NumberType},
+						},
+					},
+					{
+						Name:       "client.users.count",
+						UpdateType: Replace,
+						SQL:        "SELECT count(*) FROM users WHERE client_id = 5",
+						Account:    "agency",
+						Fields: []Field{
+							{Name: "count", Type: NumberType},
+						},
+					},
+				},
+			},
+			"",
+		},
 		{
 			filepath.Join("fixtures", "valid_config_all_envs.yml"),
 			map[string]string{
@@ -0,0 +1,187 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/guregu/null.v3"
+)
+
+var lastValueRegexp = regexp.MustCompile(`{{\s*last_value\s*}}`)
+
+// orderByRegexp matches the first term the rows are ordered by in the
+// last ORDER BY of the SQL, which is the one that orders the results
+var orderByRegexp = regexp.MustCompile(`(?is).*\border\s+by\s+([^,]*)`)
+
+var descendingRegexp = regexp.MustCompile(`(?i)\bdesc\b`)
+
+// IsIncremental reports whether the dataset only
+// queries the rows added since the last value sent
+func (ds Dataset) IsIncremental() bool {
+	return ds.CursorColumn != ""
+}
+
+// CursorField returns the field the cursor column refers to, matching
+// on the field column, key or the key generated from its name
+func (ds Dataset) CursorField() (Field, bool) {
+	key := Field{Name: ds.CursorColumn}.KeyValue()
+
+	for _, f := range ds.Fields {
+		if f.Column == ds.CursorColumn || f.KeyValue() == ds.CursorColumn || f.KeyValue() == key {
+			return f, true
+		}
+	}
+
+	return Field{}, false
+}
+
+// querySQL returns the dataset SQL with {{ last_value }} replaced by
+// the last value sent, or the initial value when nothing has been sent.
+// Number values are given as is and anything else as a quoted string.
+func (ds Dataset) querySQL() string {
+	if !ds.IsIncremental() {
+		return ds.SQL
+	}
+
+	v := ds.LastValue
+	if v == "" {
+		v = ds.InitialValue
+	}
+
+	if f, ok := ds.CursorField(); !ok || !f.isNumeric() || !isNumber(v) {
+		v = "'" + strings.Replace(v, "'", "''", -1) + "'"
+	}
+
+	return lastValueRegexp.ReplaceAllLiteralString(ds.SQL, v)
+}
+
+// cursorIndex returns the index of the cursor field, or -1
+// when the dataset isn't incremental or has no such field
+func (ds Dataset) cursorIndex() int {
+	if !ds.IsIncremental() {
+		return -1
+	}
+
+	f, ok := ds.CursorField()
+	if !ok {
+		return -1
+	}
+
+	for i, field := range ds.Fields {
+		if field == f {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// cursorValue converts a scanned column into the value the cursor is
+// tracked with. Unlike the value sent to Geckoboard datetimes keep their
+// fractional seconds, so rows within the same second aren't read again.
+func (f Field) cursorValue(col interface{}) string {
+	if d, ok := col.(*null.Time); ok && f.Type == DatetimeType {
+		if !d.Valid {
+			return ""
+		}
+
+		return d.Time.Format(time.RFC3339Nano)
+	}
+
+	return cursorString(f.value(col))
+}
+
+// maxCursorValue returns the higher of the current and next cursor values
+func maxCursorValue(f Field, current, next string) string {
+	if next == "" || current != "" && !cursorLess(f, current, next) {
+		return current
+	}
+
+	return next
+}
+
+func (ds Dataset) validateCursor() (errors []string) {
+	if !ds.IsIncremental() {
+		return nil
+	}
+
+	if ds.UpdateType != Append {
+		errors = append(errors, errCursorNotAppend)
+	}
+
+	if !lastValueRegexp.MatchString(ds.SQL) {
+		errors = append(errors, errCursorMissingLastValue)
+	}
+
+	// The last value is saved after each batch is sent, which only
+	// covers every row sent so far when they're in cursor order
+	if m := orderByRegexp.FindStringSubmatch(ds.SQL); m == nil || descendingRegexp.MatchString(m[1]) {
+		errors = append(errors, errCursorMissingOrderBy)
+	}
+
+	if ds.InitialValue == "" {
+		errors = append(errors, errMissingCursorInitialValue)
+	}
+
+	// The fields aren't known until the query has run
+	if _, ok := ds.CursorField(); !ok && !ds.InferFields {
+		errors = append(errors, fmt.Sprintf(errUnknownCursorColumn, ds.CursorColumn))
+	}
+
+	return errors
+}
+
+func (f Field) isNumeric() bool {
+	switch f.Type {
+	case NumberType, MoneyType, PercentageType, DurationType:
+		return true
+	}
+
+	return false
+}
+
+func cursorString(v interface{}) string {
+	switch n := v.(type) {
+	case nil:
+		return ""
+	case int64:
+		return strconv.FormatInt(n, 10)
+	case float32:
+		return strconv.FormatFloat(float64(n), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	}
+
+	return fmt.Sprint(v)
+}
+
+// cursorLess compares numbers and datetimes by value and anything else as
+// strings, which also orders dates correctly. Datetimes are compared as
+// times as their fractional seconds and offsets vary in length.
+func cursorLess(f Field, a, b string) bool {
+	if f.isNumeric() && isNumber(a) && isNumber(b) {
+		x, _ := strconv.ParseFloat(a, 64)
+		y, _ := strconv.ParseFloat(b, 64)
+
+		return x < y
+	}
+
+	if f.Type == DatetimeType {
+		x, errX := time.Parse(time.RFC3339Nano, a)
+		y, errY := time.Parse(time.RFC3339Nano, b)
+
+		if errX == nil && errY == nil {
+			return x.Before(y)
+		}
+	}
+
+	return a < b
+}
+
+func isNumber(v string) bool {
+	_, err := strconv.ParseFloat(v, 64)
+	return err == nil
+}
@@ -0,0 +1,191 @@
+package models
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestQuerySQL(t *testing.T) {
+	testCases := []struct {
+		dataset Dataset
+		out     string
+	}{
+		{
+			Dataset{SQL: "SELECT id FROM builds WHERE id > {{ last_value }}"},
+			"SELECT id FROM builds WHERE id > {{ last_value }}",
+		},
+		{
+			Dataset{
+				SQL:          "SELECT id FROM builds WHERE id > {{ last_value }}",
+				CursorColumn: "id",
+				InitialValue: "0",
+				Fields:       []Field{{Name: "ID", Type: NumberType}},
+			},
+			"SELECT id FROM builds WHERE id > 0",
+		},
+		{
+			Dataset{
+				SQL:          "SELECT id FROM builds WHERE id > {{last_value}}",
+				CursorColumn: "id",
+				InitialValue: "0",
+				LastValue:    "42.5",
+				Fields:       []Field{{Name: "ID", Type: NumberType}},
+			},
+			"SELECT id FROM builds WHERE id > 42.5",
+		},
+		{
+			Dataset{
+				SQL:          "SELECT created_at FROM builds WHERE created_at > {{ last_value }}",
+				CursorColumn: "Created at",
+				InitialValue: "2017-01-01",
+				LastValue:    "2017-03-21T11:12:00Z",
+				Fields:       []Field{{Name: "Created at", Type: DatetimeType}},
+			},
+			"SELECT created_at FROM builds WHERE created_at > '2017-03-21T11:12:00Z'",
+		},
+		{
+			Dataset{
+				SQL:          "SELECT app_name FROM builds WHERE app_name > {{ last_value }}",
+				CursorColumn: "app_name",
+				InitialValue: "o'reilly",
+				Fields:       []Field{{Name: "App", Type: StringType, Column: "app_name"}},
+			},
+			"SELECT app_name FROM builds WHERE app_name > 'o''reilly'",
+		},
+	}
+
+	for i, tc := range testCases {
+		if out := tc.dataset.querySQL(); out != tc.out {
+			t.Errorf("[%d] Expected SQL %q but got %q", i, tc.out, out)
+		}
+	}
+}
+
+func TestMaxCursorValue(t *testing.T) {
+	id := Field{Name: "ID", Type: NumberType}
+	createdAt := Field{Name: "Created at", Type: DatetimeType}
+
+	testCases := []struct {
+		field   Field
+		current string
+		values  []string
+		out     string
+	}{
+		{id, "", []string{"9", "10", "2"}, "10"},
+		{id, "100", []string{"9", ""}, "100"},
+		{id, "1.5", []string{"2.25"}, "2.25"},
+		{
+			createdAt,
+			"2017-03-21T11:12:00Z",
+			[]string{"2017-04-23T12:32:00Z", "2017-03-23T15:11:00Z"},
+			"2017-04-23T12:32:00Z",
+		},
+		{createdAt, "2017-03-21T11:12:00Z", nil, "2017-03-21T11:12:00Z"},
+		{
+			// Fractional seconds within the same second are kept
+			createdAt,
+			"2017-03-21T11:12:00Z",
+			[]string{"2017-03-21T11:12:00.25Z", "2017-03-21T11:12:00.5Z", "2017-03-21T11:12:00.125Z"},
+			"2017-03-21T11:12:00.5Z",
+		},
+		{
+			// Datetimes in different offsets compare as times
+			createdAt,
+			"2017-03-21T12:12:00+01:00",
+			[]string{"2017-03-21T11:12:00.5Z"},
+			"2017-03-21T11:12:00.5Z",
+		},
+	}
+
+	for i, tc := range testCases {
+		out := tc.current
+
+		for _, v := range tc.values {
+			out = maxCursorValue(tc.field, out, v)
+		}
+
+		if out != tc.out {
+			t.Errorf("[%d] Expected max value %q but got %q", i, tc.out, out)
+		}
+	}
+}
+
+func TestValidateCursor(t *testing.T) {
+	testCases := []struct {
+		dataset Dataset
+		err     []string
+	}{
+		{
+			Dataset{
+				UpdateType:   Append,
+				SQL:          "SELECT id FROM builds WHERE id > {{ last_value }} ORDER BY id",
+				CursorColumn: "id",
+				InitialValue: "0",
+				Fields:       []Field{{Name: "ID", Type: NumberType}},
+			},
+			nil,
+		},
+		{
+			Dataset{
+				UpdateType:   Append,
+				SQL:          "SELECT id FROM builds WHERE id > {{ last_value }}",
+				CursorColumn: "id",
+				InitialValue: "0",
+				Fields:       []Field{{Name: "ID", Type: NumberType}},
+			},
+			[]string{errCursorMissingOrderBy},
+		},
+		{
+			Dataset{
+				UpdateType:   Append,
+				SQL:          "SELECT id, app FROM builds WHERE id > {{ last_value }}\norder  by id DESC, app",
+				CursorColumn: "id",
+				InitialValue: "0",
+				Fields:       []Field{{Name: "ID", Type: NumberType}, {Name: "App", Type: StringType}},
+			},
+			[]string{errCursorMissingOrderBy},
+		},
+		{
+			Dataset{
+				UpdateType:   Append,
+				SQL:          "SELECT id, app FROM (SELECT * FROM builds ORDER BY app DESC) b WHERE id > {{ last_value }} ORDER BY id ASC, app DESC",
+				CursorColumn: "id",
+				InitialValue: "0",
+				Fields:       []Field{{Name: "ID", Type: NumberType}, {Name: "App", Type: StringType}},
+			},
+			nil,
+		},
+		{
+			Dataset{
+				UpdateType:   Replace,
+				SQL:          "SELECT id FROM builds",
+				CursorColumn: "build_id",
+				Fields:       []Field{{Name: "ID", Type: NumberType}},
+			},
+			[]string{
+				errCursorNotAppend,
+				errCursorMissingLastValue,
+				errCursorMissingOrderBy,
+				errMissingCursorInitialValue,
+				fmt.Sprintf(errUnknownCursorColumn, "build_id"),
+			},
+		},
+		{
+			Dataset{
+				UpdateType:   Append,
+				SQL:          "SELECT id FROM builds WHERE id > {{ last_value }} ORDER BY id",
+				CursorColumn: "id",
+				InitialValue: "0",
+				InferFields:  true,
+			},
+			nil,
+		},
+	}
+
+	for i, tc := range testCases {
+		if err := tc.dataset.validateCursor(); !reflect.DeepEqual(err, tc.err) {
+			t.Errorf("[%d] Expected errors %#v but got %#v", i, tc.err, err)
+		}
+	}
+}
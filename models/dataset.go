@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"time"
 )
 
 type DatasetType string
@@ -22,11 +23,20 @@ const (
 	DurationType   FieldType = "duration"
 )
 
+// Limits of the Geckoboard Datasets API
+const (
+	MaxFields       = 10
+	MaxRecords      = 5000
+	MaxStringLength = 100
+)
+
 var (
 	datasetNameRegexp = regexp.MustCompile(`(?)^[0-9a-z][0-9a-z._\-]{1,}[0-9a-z]$`)
 	fieldIdRegexp     = regexp.MustCompile(`[^a-z0-9 ]+|[\W]+$|^[\W]+`)
 )
 
+var currencyCodeRegexp = regexp.MustCompile(`^[A-Z]{3}$`)
+
 var fieldTypes = []FieldType{
 	NumberType,
 	DateType,
@@ -42,16 +52,27 @@ type Dataset struct {
 	UpdateType   DatasetType      `json:"-"                    yaml:"update_type"`
 	UniqueBy     []string         `json:"unique_by,omitempty"  yaml:"unique_by,omitempty"`
 	SQL          string           `json:"-"                    yaml:"sql"`
+	DeleteSQL    string           `json:"-"                    yaml:"delete_sql,omitempty"`
+	Database     string           `json:"-"                    yaml:"database,omitempty"`
+	Account      string           `json:"-"                    yaml:"account,omitempty"`
+	Schedule     string           `json:"-"                    yaml:"schedule,omitempty"`
+	QueryTimeout time.Duration    `json:"-"                    yaml:"query_timeout,omitempty"`
+	CursorColumn string           `json:"-"                    yaml:"cursor_column,omitempty"`
+	InitialValue string           `json:"-"                    yaml:"cursor_initial_value,omitempty"`
+	LastValue    string           `json:"-"                    yaml:"-"`
+	InferFields  bool             `json:"-"                    yaml:"infer_fields,omitempty"`
+	AutoRecreate bool             `json:"-"                    yaml:"recreate_on_schema_change,omitempty"`
 	Fields       []Field          `json:"-"                    yaml:"fields"`
 	SchemaFields map[string]Field `json:"fields"               yaml:"-"`
 }
 
 type Field struct {
 	Type         FieldType `json:"type"                     yaml:"type"`
-	Key          string    `json:"-"                        yaml:"key"`
+	Key          string    `json:"-"                        yaml:"key,omitempty"`
 	Name         string    `json:"name"                     yaml:"name"`
-	CurrencyCode string    `json:"currency_code,omitempty"  yaml:"currency_code"`
-	TimeUnit     string    `json:"time_unit,omitempty"      yaml:"time_unit"`
+	Column       string    `json:"-"                        yaml:"column,omitempty"`
+	CurrencyCode string    `json:"currency_code,omitempty"  yaml:"currency_code,omitempty"`
+	TimeUnit     string    `json:"time_unit,omitempty"      yaml:"time_unit,omitempty"`
 	Optional     bool      `json:"optional,omitempty"       yaml:"optional,omitempty"`
 }
 
@@ -137,6 +158,16 @@ func (ds Dataset) updateUniqueByKeys(newFields map[string]Field) ([]string, erro
 	return newUniqueByKeys, nil
 }
 
+// EffectiveQueryTimeout returns the dataset query timeout if set,
+// otherwise the database wide timeout, zero meaning no timeout
+func (ds Dataset) EffectiveQueryTimeout(dc *DatabaseConfig) time.Duration {
+	if ds.QueryTimeout > 0 || dc == nil {
+		return ds.QueryTimeout
+	}
+
+	return dc.QueryTimeout
+}
+
 func (ds Dataset) Validate() (errors []string) {
 	if ds.Name == "" {
 		errors = append(errors, errMissingDatasetName)
@@ -155,10 +186,28 @@ func (ds Dataset) Validate() (errors []string) {
 		errors = append(errors, errMissingDatasetSQL)
 	}
 
-	if len(ds.Fields) == 0 {
+	if len(ds.Fields) == 0 && !ds.InferFields {
 		errors = append(errors, errMissingDatasetFields)
 	}
 
+	if len(ds.Fields) > 0 && ds.InferFields {
+		errors = append(errors, errInferFieldsWithFields)
+	}
+
+	if len(ds.Fields) > MaxFields {
+		errors = append(errors, fmt.Sprintf(errTooManyFields, len(ds.Fields), MaxFields))
+	}
+
+	if ds.QueryTimeout < 0 {
+		errors = append(errors, fmt.Sprintf(errInvalidQueryTimeout, ds.QueryTimeout))
+	}
+
+	if ds.Schedule != "" {
+		if _, err := ParseSchedule(ds.Schedule); err != nil {
+			errors = append(errors, fmt.Sprintf(errInvalidDatasetSchedule, ds.Schedule, err))
+		}
+	}
+
 	for _, f := range ds.Fields {
 		errors = append(errors, f.Validate()...)
 	}
@@ -167,6 +216,11 @@ func (ds Dataset) Validate() (errors []string) {
 		errors = append(errors, err)
 	}
 
+	errors = append(errors, ds.validateFieldColumns()...)
+	errors = append(errors, ds.validateUniqueBy()...)
+	errors = append(errors, ds.validateCursor()...)
+	errors = append(errors, ds.validateDeleteSQL()...)
+
 	return errors
 }
 
@@ -192,6 +246,10 @@ func (f Field) Validate() (errors []string) {
 		errors = append(errors, errMissingCurrency)
 	}
 
+	if f.Type == MoneyType && f.CurrencyCode != "" && !currencyCodeRegexp.MatchString(f.CurrencyCode) {
+		errors = append(errors, fmt.Sprintf(errInvalidCurrency, f.CurrencyCode))
+	}
+
 	if f.Type == DurationType && f.TimeUnit == "" {
 		errors = append(errors, errMissingTimeUnit)
 	}
@@ -199,6 +257,90 @@ func (f Field) Validate() (errors []string) {
 	return errors
 }
 
+// ValidateRecordCount checks the number of records a query returned fits in
+// the dataset, so that a replace isn't started which can't be completed
+func (ds Dataset) ValidateRecordCount(n int) error {
+	if ds.UpdateType == Replace && n > MaxRecords {
+		return fmt.Errorf(errTooManyRecords, MaxRecords, ds.Name)
+	}
+
+	return nil
+}
+
+// validateUniqueBy checks each unique_by refers to a different field,
+// matching on either the field key or the key generated from its name
+func (ds Dataset) validateUniqueBy() (errors []string) {
+	// The fields aren't known until the query has run
+	if ds.InferFields {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+
+	for _, ub := range ds.UniqueBy {
+		f, found := ds.uniqueByField(ub)
+
+		switch {
+		case !found:
+			errors = append(errors, fmt.Sprintf(errUnknownUniqueBy, ub))
+		case seen[f.KeyValue()]:
+			errors = append(errors, fmt.Sprintf(errDuplicateUniqueBy, ub))
+		}
+
+		seen[f.KeyValue()] = true
+	}
+
+	return errors
+}
+
+// uniqueByField returns the field a unique_by refers to
+func (ds Dataset) uniqueByField(ub string) (Field, bool) {
+	key := Field{Name: ub}.KeyValue()
+
+	for _, f := range ds.Fields {
+		if k := f.KeyValue(); k == ub || k == key {
+			return f, true
+		}
+	}
+
+	return Field{}, false
+}
+
+// MapsColumnsByName reports whether the fields are matched to
+// the query result columns by name rather than by position
+func (ds Dataset) MapsColumnsByName() bool {
+	for _, f := range ds.Fields {
+		if f.Column != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validateFieldColumns checks that when any field maps to a column by name
+// every field does, and that no two fields map to the same column
+func (ds Dataset) validateFieldColumns() (errors []string) {
+	if !ds.MapsColumnsByName() {
+		return nil
+	}
+
+	columns := make(map[string]bool)
+
+	for _, f := range ds.Fields {
+		switch {
+		case f.Column == "":
+			errors = append(errors, fmt.Sprintf(errMissingFieldColumn, f.Name))
+		case columns[f.Column]:
+			errors = append(errors, fmt.Sprintf(errDuplicateFieldColumn, f.Column))
+		}
+
+		columns[f.Column] = true
+	}
+
+	return errors
+}
+
 func (ds Dataset) validateGeneratedFieldKeysUnique() string {
 	uniqueNameMap := make(map[string]interface{})
 	var names []string
@@ -3,6 +3,7 @@ package models
 import (
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -298,6 +299,41 @@ func TestDatasetValidate(t *testing.T) {
 				errMissingFieldName,
 			},
 		},
+		{
+			Dataset{
+				Name:        "app.builds",
+				UpdateType:  Replace,
+				SQL:         "SELECT 1",
+				InferFields: true,
+			},
+			nil,
+		},
+		{
+			Dataset{
+				Name:        "app.builds",
+				UpdateType:  Replace,
+				SQL:         "SELECT 1",
+				InferFields: true,
+				Fields:      []Field{{Name: "count", Type: "number"}},
+			},
+			[]string{errInferFieldsWithFields},
+		},
+		{
+			Dataset{
+				Name:       "app.builds",
+				UpdateType: Replace,
+				SQL:        "SELECT 1",
+				Fields: []Field{
+					{Name: "App", Type: StringType, Column: "app_name"},
+					{Name: "Cost", Type: NumberType},
+					{Name: "Count", Type: NumberType, Column: "app_name"},
+				},
+			},
+			[]string{
+				fmt.Sprintf(errMissingFieldColumn, "Cost"),
+				fmt.Sprintf(errDuplicateFieldColumn, "app_name"),
+			},
+		},
 		{
 			Dataset{
 				Name:       "c",
@@ -509,6 +545,97 @@ func TestDatasetValidate(t *testing.T) {
 			},
 			nil,
 		},
+		{
+			Dataset{
+				Name:       "users.count",
+				UpdateType: Replace,
+				SQL:        "SELECT * FROM some_funky_table;",
+				Schedule:   "*/5 * * * *",
+				Fields:     []Field{{Name: "count", Type: "number"}},
+			},
+			nil,
+		},
+		{
+			Dataset{
+				Name:       "users.count",
+				UpdateType: Replace,
+				SQL:        "SELECT * FROM some_funky_table;",
+				Schedule:   "every day",
+				Fields:     []Field{{Name: "count", Type: "number"}},
+			},
+			[]string{
+				fmt.Sprintf(errInvalidDatasetSchedule, "every day", "expected 5 cron fields but got 2"),
+			},
+		},
+		{
+			Dataset{
+				Name:       "app.build.cost",
+				UpdateType: Replace,
+				SQL:        "SELECT * FROM some_funky_table;",
+				Fields:     []Field{{Name: "cost", Type: MoneyType, CurrencyCode: "dollars"}},
+			},
+			[]string{fmt.Sprintf(errInvalidCurrency, "dollars")},
+		},
+		{
+			Dataset{
+				Name:       "app.builds",
+				UpdateType: Replace,
+				SQL:        "SELECT * FROM some_funky_table;",
+				Fields: []Field{
+					{Name: "a", Type: "number"}, {Name: "b", Type: "number"}, {Name: "c", Type: "number"},
+					{Name: "d", Type: "number"}, {Name: "e", Type: "number"}, {Name: "f", Type: "number"},
+					{Name: "g", Type: "number"}, {Name: "h", Type: "number"}, {Name: "i", Type: "number"},
+					{Name: "j", Type: "number"}, {Name: "k", Type: "number"},
+				},
+			},
+			[]string{fmt.Sprintf(errTooManyFields, 11, MaxFields)},
+		},
+		{
+			Dataset{
+				Name:       "app.builds",
+				UpdateType: Append,
+				SQL:        "SELECT * FROM some_funky_table;",
+				UniqueBy:   []string{"App Name", "app_name", "build_id"},
+				Fields: []Field{
+					{Name: "App Name", Type: StringType, Key: "app_name"},
+					{Name: "Build ID", Type: NumberType},
+				},
+			},
+			[]string{fmt.Sprintf(errDuplicateUniqueBy, "app_name")},
+		},
+		{
+			Dataset{
+				Name:       "app.builds",
+				UpdateType: Append,
+				SQL:        "SELECT * FROM some_funky_table;",
+				UniqueBy:   []string{"Build ID", "triggered_by"},
+				Fields: []Field{
+					{Name: "Build ID", Type: NumberType},
+				},
+			},
+			[]string{fmt.Sprintf(errUnknownUniqueBy, "triggered_by")},
+		},
+		{
+			Dataset{
+				Name:       "app.builds",
+				UpdateType: Replace,
+				SQL:        "SELECT * FROM some_funky_table;",
+				DeleteSQL:  "SELECT id FROM deleted_builds",
+				Fields:     []Field{{Name: "ID", Type: NumberType}},
+			},
+			[]string{errDeleteSQLNotAppend, errDeleteSQLWithoutUniqueBy},
+		},
+		{
+			Dataset{
+				Name:       "app.builds",
+				UpdateType: Append,
+				SQL:        "SELECT * FROM some_funky_table;",
+				DeleteSQL:  "SELECT id FROM deleted_builds",
+				UniqueBy:   []string{"id"},
+				Fields:     []Field{{Name: "ID", Type: NumberType}},
+			},
+			nil,
+		},
 	}
 
 	for i, tc := range testCases {
@@ -532,6 +659,56 @@ func TestDatasetValidate(t *testing.T) {
 	}
 }
 
+func TestValidateRecordCount(t *testing.T) {
+	testCases := []struct {
+		updateType DatasetType
+		records    int
+		err        string
+	}{
+		{Replace, MaxRecords, ""},
+		{Replace, MaxRecords + 1, fmt.Sprintf(errTooManyRecords, MaxRecords, "app.builds")},
+		{Append, MaxRecords + 1, ""},
+	}
+
+	for i, tc := range testCases {
+		ds := Dataset{Name: "app.builds", UpdateType: tc.updateType}
+		err := ds.ValidateRecordCount(tc.records)
+
+		switch {
+		case err == nil && tc.err != "":
+			t.Errorf("[%d] Expected error %s but got none", i, tc.err)
+		case err != nil && err.Error() != tc.err:
+			t.Errorf("[%d] Expected error %s but got %s", i, tc.err, err)
+		}
+	}
+}
+
+func TestFieldValidateValue(t *testing.T) {
+	f := Field{Name: "App", Type: StringType}
+
+	testCases := []struct {
+		value interface{}
+		err   string
+	}{
+		{strings.Repeat("a", MaxStringLength), ""},
+		{strings.Repeat("é", MaxStringLength), ""},
+		{strings.Repeat("a", MaxStringLength+1), fmt.Sprintf(errStringTooLong, "App", MaxStringLength+1, MaxStringLength)},
+		{12.5, ""},
+		{nil, ""},
+	}
+
+	for i, tc := range testCases {
+		err := f.validateValue(tc.value)
+
+		switch {
+		case err == nil && tc.err != "":
+			t.Errorf("[%d] Expected error %s but got none", i, tc.err)
+		case err != nil && err.Error() != tc.err:
+			t.Errorf("[%d] Expected error %s but got %s", i, tc.err, err)
+		}
+	}
+}
+
 func TestFieldKeyValue(t *testing.T) {
 	testCases := []struct {
 		field Field
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// HasDeletions reports whether the dataset deletes the
+// records returned by its delete_sql from Geckoboard
+func (ds Dataset) HasDeletions() bool {
+	return ds.DeleteSQL != ""
+}
+
+// BuildDeletions runs the delete_sql query for a dataset entry, returning
+// the unique_by values of each record to delete. The query must return a
+// column for each unique_by, in the same order.
+func (ds Dataset) BuildDeletions(ctx context.Context, dc *DatabaseConfig, db *sql.DB) (DatasetRows, error) {
+	fields := make([]Field, len(ds.UniqueBy))
+
+	for i, ub := range ds.UniqueBy {
+		f, ok := ds.uniqueByField(ub)
+		if !ok {
+			return nil, fmt.Errorf(errUnknownUniqueBy, ub)
+		}
+
+		fields[i] = f
+	}
+
+	records := DatasetRows{}
+
+	err := ds.query(ctx, dc, db, ds.DeleteSQL, func(rows *sql.Rows, _ *queryTimer) error {
+		cols, err := rows.Columns()
+		if err != nil {
+			return fmt.Errorf(errParseSQLResultSet, err)
+		}
+
+		if len(cols) != len(fields) {
+			return fmt.Errorf(errDeleteColumnCount, ds.Name, len(cols), len(fields),
+				strings.Join(ds.UniqueBy, `", "`))
+		}
+
+		for rows.Next() {
+			dest := make([]interface{}, len(fields))
+			for i, f := range fields {
+				dest[i] = f.fieldTypeMapping()
+			}
+
+			if err := rows.Scan(dest...); err != nil {
+				return fmt.Errorf(errParseSQLResultSet, err)
+			}
+
+			data := make(map[string]interface{})
+			for i, f := range fields {
+				data[f.KeyValue()] = f.value(dest[i])
+			}
+
+			records = append(records, data)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func (ds Dataset) validateDeleteSQL() (errors []string) {
+	if !ds.HasDeletions() {
+		return nil
+	}
+
+	if ds.UpdateType != Append {
+		errors = append(errors, errDeleteSQLNotAppend)
+	}
+
+	if len(ds.UniqueBy) == 0 {
+		errors = append(errors, errDeleteSQLWithoutUniqueBy)
+	}
+
+	return errors
+}
@@ -12,17 +12,79 @@ const (
 	errMissingDBDriver    = "No dataset driver provided."
 	errMissingAPIKey      = "No Geckoboard API key provided."
 
+	errInvalidQueryTimeout = "The query_timeout %s must not be negative."
+
+	errNamedDatabase   = `Database "%s": %s`
+	errUnknownDatabase = `"%s" is not a configured database for the dataset %s.`
+
+	errMissingDatasetDatabase = "No database provided for the dataset %s. " +
+		"Datasets must set database when more than one is configured."
+
+	errNamedAccount   = `Geckoboard account "%s": %s`
+	errUnknownAccount = `"%s" is not a configured Geckoboard account for the dataset %s.`
+
+	errMissingDatasetAccount = "No Geckoboard account provided for the dataset %s. " +
+		"Datasets must set account when more than one is configured."
+
+	errInvalidBackoff         = "The retries initial_backoff and max_backoff must not be negative."
+	errInitialBackoffTooLarge = "The retries initial_backoff %s must not be larger than the max_backoff %s."
+
+	errInvalidMaxInterval = "The skip_unchanged max_interval %s must not be negative."
+
+	errInvalidRateLimit = "The rate_limit must not be negative."
+	errRateLimitBothSet = "The rate_limit can be given as requests_per_second or " +
+		"requests_per_minute, but not both."
+	errMissingRateLimit = "The rate_limit requires either requests_per_second " +
+		"or requests_per_minute."
+
 	// SQL
 	errFailedSQLQuery    = "Query failed. This is the error received: %s"
 	errParseSQLResultSet = "Parsing query results failed. " +
 		"This is the error received: %s"
 
+	errQueryTimedOut  = "the query timed out after %s"
+	errQueryCancelled = "the query was cancelled"
+
+	errColumnCountMismatch = `The query for the dataset %s returns %d columns but %d fields are configured. ` +
+		`Expected columns for the fields "%s" but got the columns "%s".`
+
+	errDeleteColumnCount = `The delete_sql for the dataset %s returns %d columns but there are %d unique_by fields "%s".`
+
+	errMissingQueryColumn  = `The column "%s" for the field "%s" is not in the query results.`
+	errUnmappedQueryColumn = `The column "%s" in the query results is not mapped to a field.`
+
+	errStringTooLong = `The value for the field "%s" is %d characters but a string can be at most %d.`
+	errInvalidRecord = "Record %d of the dataset %s can't be sent. %s"
+
+	errPreviewNoField  = "no field for this column"
+	errPreviewNoColumn = "no column for this field"
+
 	// Dataset validations
 	errNoDatasets           = "At least one dataset is required to run"
 	errMissingDatasetName   = "No dataset name provided."
 	errMissingDatasetSQL    = "No SQL query provided."
 	errMissingDatasetFields = "No dataset fields provided."
 
+	errInferFieldsWithFields = "Fields can't be provided when infer_fields is set."
+
+	errTooManyFields  = "There are %d fields but a dataset can hold at most %d."
+	errTooManyRecords = "The query returned more than the %d records the replace dataset %s " +
+		"can hold. Please limit the query or use the append update type."
+
+	errCursorNotAppend        = "A cursor_column can only be used with the append update type."
+	errCursorMissingLastValue = "The SQL must use {{ last_value }} when a cursor_column is provided."
+	errCursorMissingOrderBy   = "The SQL must ORDER BY the cursor_column in ascending order, " +
+		"so that no rows are skipped when an update fails partway through."
+
+	errMissingCursorInitialValue = "No cursor_initial_value provided for the cursor_column."
+	errUnknownCursorColumn       = `The cursor_column "%s" doesn't match a field.`
+
+	errDeleteSQLNotAppend       = "A delete_sql can only be used with the append update type."
+	errDeleteSQLWithoutUniqueBy = "A delete_sql requires unique_by to identify the records to delete."
+
+	errUnknownUniqueBy   = `The unique_by "%s" doesn't match a field name or key.`
+	errDuplicateUniqueBy = `The unique_by "%s" refers to a field more than once.`
+
 	errInvalidDatasetName = "Invalid dataset name. Dataset names must be at " +
 		"least 3 characters in length, and use only lowercase letters, " +
 		"numbers, dots, hyphens, and underscores."
@@ -30,6 +92,10 @@ const (
 	errInvalidDatasetUpdateType = `"%s" is not a valid update type. ` +
 		`Update type must be either append or replace.`
 
+	errInvalidDatasetSchedule = `"%s" is not a valid schedule (%s). ` +
+		`Schedule must be a cron expression such as "*/5 * * * *" ` +
+		`or an interval such as "@every 10m".`
+
 	// Dataset field validations
 	errMissingFieldName = "No field name provided."
 
@@ -39,9 +105,17 @@ const (
 	errMissingCurrency = "No currency_code provided for the money field %s. " +
 		"Please provide an ISO4217 currency code."
 
+	errInvalidCurrency = `"%s" is not a valid currency_code. ` +
+		"Please provide a three letter ISO4217 currency code such as USD."
+
 	errMissingTimeUnit = "No time_unit provided for the duration field %s. " +
 		"Please provide one of milliseconds, seconds, minutes or hours"
 
 	errDuplicateFieldNames = `The field names "%s" will create duplicate keys. ` +
 		`Please revise using a unique combination of letters and numbers.`
+
+	errMissingFieldColumn = `No column provided for the field "%s". ` +
+		`When any field sets a column every field must.`
+
+	errDuplicateFieldColumn = `The column "%s" is mapped to more than one field.`
 )
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	numberColumnTypes = []string{
+		"BIGINT", "BIT", "DECIMAL", "DOUBLE", "FLOAT", "FLOAT4", "FLOAT8",
+		"INT", "INT2", "INT4", "INT8", "INTEGER", "MEDIUMINT", "MONEY",
+		"NUMERIC", "REAL", "SMALLINT", "SMALLMONEY", "TINYINT",
+		"UNSIGNED BIGINT", "UNSIGNED INT", "UNSIGNED MEDIUMINT",
+		"UNSIGNED SMALLINT", "UNSIGNED TINYINT",
+	}
+
+	datetimeColumnTypes = []string{
+		"DATETIME", "DATETIME2", "DATETIMEOFFSET", "SMALLDATETIME",
+		"TIMESTAMP", "TIMESTAMPTZ",
+	}
+
+	dateColumnTypes = []string{"DATE"}
+)
+
+// InferFields builds a field for each result set column from the column
+// type reported by the driver, using the column name as the field name.
+// Numeric columns become numbers, timestamps datetimes, dates dates and
+// anything else a string. Numbers are optional unless the driver reports
+// the column can't be null.
+func InferFields(cols []*sql.ColumnType) []Field {
+	fields := make([]Field, len(cols))
+
+	for i, col := range cols {
+		f := Field{Name: col.Name(), Type: inferFieldType(col)}
+
+		if f.Type == NumberType {
+			nullable, ok := col.Nullable()
+			f.Optional = nullable || !ok
+		}
+
+		fields[i] = f
+	}
+
+	return fields
+}
+
+func inferFieldType(col *sql.ColumnType) FieldType {
+	name := strings.ToUpper(col.DatabaseTypeName())
+
+	// Some types include a size or precision such as DECIMAL(10,2)
+	if i := strings.Index(name, "("); i >= 0 {
+		name = strings.TrimSpace(name[:i])
+	}
+
+	switch {
+	case containsString(numberColumnTypes, name):
+		return NumberType
+	case containsString(datetimeColumnTypes, name):
+		return DatetimeType
+	case containsString(dateColumnTypes, name):
+		return DateType
+	case name != "":
+		return StringType
+	}
+
+	// Without a type name, such as for SQLite expressions,
+	// fall back to the Go type the driver scans into
+	if st := col.ScanType(); st != nil {
+		switch st.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			return NumberType
+		}
+
+		if st == reflect.TypeOf(time.Time{}) {
+			return DatetimeType
+		}
+	}
+
+	return StringType
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
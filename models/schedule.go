@@ -0,0 +1,270 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule determines when a dataset should next be refreshed
+type Schedule interface {
+	Next(time.Time) time.Time
+}
+
+type intervalSchedule struct {
+	interval time.Duration
+}
+
+// Next returns the time one interval after t
+func (s intervalSchedule) Next(t time.Time) time.Time {
+	return t.Add(s.interval)
+}
+
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+
+	// When both day of month and day of week are restricted
+	// a day matching either of them is used, as with cron
+	domStar, dowStar bool
+}
+
+type cronBounds struct {
+	min, max uint
+	names    map[string]uint
+}
+
+var (
+	minuteBounds = cronBounds{0, 59, nil}
+	hourBounds   = cronBounds{0, 23, nil}
+	domBounds    = cronBounds{1, 31, nil}
+
+	monthBounds = cronBounds{1, 12, map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+
+	dowBounds = cronBounds{0, 7, map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+
+	scheduleDescriptors = map[string]string{
+		"@yearly":   "0 0 1 1 *",
+		"@annually": "0 0 1 1 *",
+		"@monthly":  "0 0 1 * *",
+		"@weekly":   "0 0 * * 0",
+		"@daily":    "0 0 * * *",
+		"@midnight": "0 0 * * *",
+		"@hourly":   "0 * * * *",
+	}
+)
+
+// ParseSchedule parses either a standard five field cron expression
+// (minute, hour, day of month, month, day of week), one of the
+// descriptors such as @hourly or @daily, or an interval given as
+// "@every 5m" or simply "5m"
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	if spec == "" {
+		return nil, errors.New("schedule is empty")
+	}
+
+	if strings.HasPrefix(spec, "@every ") {
+		return parseInterval(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+	}
+
+	if d, ok := scheduleDescriptors[strings.ToLower(spec)]; ok {
+		spec = d
+	}
+
+	if _, err := time.ParseDuration(spec); err == nil {
+		return parseInterval(spec)
+	}
+
+	return parseCron(spec)
+}
+
+func parseInterval(spec string) (Schedule, error) {
+	d, err := time.ParseDuration(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	if d < time.Second {
+		return nil, fmt.Errorf("interval %s must be at least one second", spec)
+	}
+
+	return intervalSchedule{interval: d}, nil
+}
+
+func parseCron(spec string) (Schedule, error) {
+	fields := strings.Fields(spec)
+
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 cron fields but got %d", len(fields))
+	}
+
+	var (
+		s   cronSchedule
+		err error
+	)
+
+	if s.minute, err = parseCronField(fields[0], minuteBounds); err != nil {
+		return nil, err
+	}
+
+	if s.hour, err = parseCronField(fields[1], hourBounds); err != nil {
+		return nil, err
+	}
+
+	if s.dom, err = parseCronField(fields[2], domBounds); err != nil {
+		return nil, err
+	}
+
+	if s.month, err = parseCronField(fields[3], monthBounds); err != nil {
+		return nil, err
+	}
+
+	if s.dow, err = parseCronField(fields[4], dowBounds); err != nil {
+		return nil, err
+	}
+
+	// Allow 7 as sunday as many cron implementations do
+	if s.dow&(1<<7) > 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+
+	s.domStar = fields[2] == "*" || fields[2] == "?"
+	s.dowStar = fields[4] == "*" || fields[4] == "?"
+
+	if s.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("%q never matches a date", spec)
+	}
+
+	return s, nil
+}
+
+// parseCronField converts a comma separated list of values,
+// ranges and steps into a bitset of the matching values
+func parseCronField(field string, b cronBounds) (bits uint64, err error) {
+	for _, part := range strings.Split(field, ",") {
+		var (
+			rng       = part
+			step uint = 1
+		)
+
+		if i := strings.Index(part, "/"); i >= 0 {
+			rng = part[:i]
+
+			s, err := strconv.ParseUint(part[i+1:], 10, 8)
+			if err != nil || s == 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+
+			step = uint(s)
+		}
+
+		var start, end uint
+
+		switch {
+		case rng == "*" || rng == "?":
+			start, end = b.min, b.max
+		case strings.Contains(rng, "-"):
+			bounds := strings.SplitN(rng, "-", 2)
+
+			if start, err = b.value(bounds[0]); err != nil {
+				return 0, err
+			}
+
+			if end, err = b.value(bounds[1]); err != nil {
+				return 0, err
+			}
+		default:
+			if start, err = b.value(rng); err != nil {
+				return 0, err
+			}
+
+			end = start
+
+			// A single value with a step such as 5/15 runs to the max
+			if step > 1 {
+				end = b.max
+			}
+		}
+
+		if start > end {
+			return 0, fmt.Errorf("invalid range %q", rng)
+		}
+
+		for v := start; v <= end; v += step {
+			bits |= 1 << v
+		}
+	}
+
+	return bits, nil
+}
+
+func (b cronBounds) value(v string) (uint, error) {
+	if n, ok := b.names[strings.ToLower(v)]; ok {
+		return n, nil
+	}
+
+	n, err := strconv.ParseUint(v, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", v)
+	}
+
+	if uint(n) < b.min || uint(n) > b.max {
+		return 0, fmt.Errorf("value %d out of range %d-%d", n, b.min, b.max)
+	}
+
+	return uint(n), nil
+}
+
+// Next returns the first time after t matching the cron expression
+func (s cronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	// Expressions that can never match, such as the 30th of February,
+	// give up after searching a few years ahead
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+func (s cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) > 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) > 0
+
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+
+	return domMatch || dowMatch
+}
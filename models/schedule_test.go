@@ -0,0 +1,140 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	from := time.Date(2021, time.March, 10, 14, 23, 45, 0, time.UTC) // A wednesday
+
+	testCases := []struct {
+		spec string
+		next []time.Time
+		err  string
+	}{
+		{
+			spec: "@every 5m",
+			next: []time.Time{
+				time.Date(2021, time.March, 10, 14, 28, 45, 0, time.UTC),
+				time.Date(2021, time.March, 10, 14, 33, 45, 0, time.UTC),
+			},
+		},
+		{
+			spec: "90s",
+			next: []time.Time{
+				time.Date(2021, time.March, 10, 14, 25, 15, 0, time.UTC),
+			},
+		},
+		{
+			spec: "*/15 * * * *",
+			next: []time.Time{
+				time.Date(2021, time.March, 10, 14, 30, 0, 0, time.UTC),
+				time.Date(2021, time.March, 10, 14, 45, 0, 0, time.UTC),
+				time.Date(2021, time.March, 10, 15, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "@daily",
+			next: []time.Time{
+				time.Date(2021, time.March, 11, 0, 0, 0, 0, time.UTC),
+				time.Date(2021, time.March, 12, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "0 6 1 * *",
+			next: []time.Time{
+				time.Date(2021, time.April, 1, 6, 0, 0, 0, time.UTC),
+				time.Date(2021, time.May, 1, 6, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "30 9-17/4 * * mon-fri",
+			next: []time.Time{
+				time.Date(2021, time.March, 10, 17, 30, 0, 0, time.UTC),
+				time.Date(2021, time.March, 11, 9, 30, 0, 0, time.UTC),
+				time.Date(2021, time.March, 11, 13, 30, 0, 0, time.UTC),
+			},
+		},
+		{
+			// Sunday can be given as 7
+			spec: "0 0 * * 7",
+			next: []time.Time{
+				time.Date(2021, time.March, 14, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			// Day of month or day of week when both are restricted
+			spec: "0 0 13 * fri",
+			next: []time.Time{
+				time.Date(2021, time.March, 12, 0, 0, 0, 0, time.UTC),
+				time.Date(2021, time.March, 13, 0, 0, 0, 0, time.UTC),
+				time.Date(2021, time.March, 19, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "0 0 29 feb *",
+			next: []time.Time{
+				time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "",
+			err:  "schedule is empty",
+		},
+		{
+			spec: "@every 100ms",
+			err:  "interval 100ms must be at least one second",
+		},
+		{
+			spec: "* * * *",
+			err:  "expected 5 cron fields but got 4",
+		},
+		{
+			spec: "60 * * * *",
+			err:  "value 60 out of range 0-59",
+		},
+		{
+			spec: "5-1 * * * *",
+			err:  `invalid range "5-1"`,
+		},
+		{
+			spec: "*/0 * * * *",
+			err:  `invalid step in "*/0"`,
+		},
+		{
+			spec: "0 0 * * funday",
+			err:  `invalid value "funday"`,
+		},
+		{
+			spec: "0 0 30 2 *",
+			err:  `"0 0 30 2 *" never matches a date`,
+		},
+	}
+
+	for i, tc := range testCases {
+		s, err := ParseSchedule(tc.spec)
+
+		if tc.err == "" && err != nil {
+			t.Errorf("[%d] Expected no error but got %s", i, err)
+			continue
+		}
+
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("[%d] Expected error %s but got %v", i, tc.err, err)
+			}
+
+			continue
+		}
+
+		next := from
+		for j, exp := range tc.next {
+			next = s.Next(next)
+
+			if !next.Equal(exp) {
+				t.Errorf("[%d-%d] Expected next run %s but got %s", i, j, exp, next)
+			}
+		}
+	}
+}
@@ -1,98 +1,436 @@
 package models
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"net"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"gopkg.in/guregu/null.v3"
 
 	_ "github.com/denisenkom/go-mssqldb"
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 const dateFormat = "2006-01-02"
 
+// PreviewCell holds a column value converted as it would be sent
+// to Geckoboard, or the error converting it to the field type
+type PreviewCell struct {
+	Value interface{}
+	Err   error
+}
+
+// Preview holds the column names and first rows of a dataset query
+type Preview struct {
+	Columns []string
+	Rows    [][]PreviewCell
+}
+
 // DatasetRows holds a slice of map[string]interface{}
 // which is used to send to a geckoboard dataset
 type DatasetRows []map[string]interface{}
 
-// BuildDataset calls queryDatasource to query the datasource for a
-// dataset entry and builds up a slice of rows ready for processing by the client
-func (ds Dataset) BuildDataset(dc *DatabaseConfig, db *sql.DB) (DatasetRows, error) {
+// BuildDataset queries the datasource for a dataset entry and builds
+// up a slice of rows ready for processing by the client. When the
+// dataset infers its fields they are set from the query result columns.
+func (ds *Dataset) BuildDataset(ctx context.Context, dc *DatabaseConfig, db *sql.DB) (DatasetRows, error) {
 	datasetRecs := DatasetRows{}
-	recs, err := ds.queryDatasource(dc, db)
+
+	err := ds.StreamDataset(ctx, dc, db, 0, func(batch DatasetRows, _ string) error {
+		datasetRecs = append(datasetRecs, batch...)
+		return nil
+	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	for _, row := range recs {
+	return datasetRecs, nil
+}
+
+// StreamDataset queries the datasource for a dataset entry and passes its rows
+// to fn in batches of size as they are read, so at most one batch is held in
+// memory. The last batch holds the remaining rows, and when there are no rows
+// fn is called once with an empty batch. A size of zero passes every row in a
+// single batch. Reading stops with an error as soon as a replace dataset has
+// more rows than it can hold. For an incremental dataset each batch is passed
+// with the highest cursor value read so far, starting from the LastValue.
+func (ds *Dataset) StreamDataset(ctx context.Context, dc *DatabaseConfig, db *sql.DB, size int, fn func(batch DatasetRows, lastValue string) error) error {
+	var (
+		batch     = make(DatasetRows, 0, size)
+		count     = 0
+		sent      = false
+		lastValue = ds.LastValue
+		cursor    = -1
+	)
+
+	err := ds.queryDatasource(ctx, dc, db, func(row []interface{}) error {
+		count++
+
+		if err := ds.ValidateRecordCount(count); err != nil {
+			return err
+		}
+
+		// Inferred fields are only known once the query has run
+		if count == 1 {
+			cursor = ds.cursorIndex()
+		}
+
+		if cursor >= 0 {
+			f := ds.Fields[cursor]
+			lastValue = maxCursorValue(f, lastValue, f.cursorValue(row[cursor]))
+		}
+
 		data := make(map[string]interface{})
 
-		for i, col := range row.([]interface{}) {
+		for i, col := range row {
 			f := ds.Fields[i]
-			k := f.KeyValue()
-
-			switch f.Type {
-			case NumberType, MoneyType, PercentageType, DurationType:
-				data[k] = col.(*Number).Value(f.Optional)
-			case StringType:
-				data[k] = col.(*null.String).String
-			case DateType:
-				d := col.(*null.Time)
-				if d.Valid {
-					data[k] = d.Time.Format(dateFormat)
-				} else {
-					data[k] = nil
-				}
-			case DatetimeType:
-				d := col.(*null.Time)
-				if d.Valid {
-					data[k] = d.Time.Format(time.RFC3339)
-				} else {
-					data[k] = nil
-				}
+			v := f.value(col)
+
+			if err := f.validateValue(v); err != nil {
+				return fmt.Errorf(errInvalidRecord, count, ds.Name, err)
 			}
+
+			data[f.KeyValue()] = v
+		}
+
+		batch = append(batch, data)
+
+		if size == 0 || len(batch) < size {
+			return nil
 		}
 
-		datasetRecs = append(datasetRecs, data)
+		sent = true
+		err := fn(batch, lastValue)
+		batch = make(DatasetRows, 0, size)
+
+		return err
+	})
+
+	if err != nil {
+		return err
 	}
 
-	return datasetRecs, nil
+	if len(batch) > 0 || !sent {
+		return fn(batch, lastValue)
+	}
+
+	return nil
 }
 
-func (ds Dataset) queryDatasource(dc *DatabaseConfig, db *sql.DB) (records []interface{}, err error) {
-	rows, err := db.Query(ds.SQL)
+// PreviewDataset queries the datasource for a dataset entry and converts up to
+// limit rows cell by cell, so that each value which can't be converted to its
+// field type is reported individually rather than failing the whole query
+func (ds *Dataset) PreviewDataset(ctx context.Context, dc *DatabaseConfig, db *sql.DB, limit int) (*Preview, error) {
+	p := &Preview{}
+
+	err := ds.query(ctx, dc, db, ds.querySQL(), func(rows *sql.Rows, _ *queryTimer) error {
+		cols, err := rows.Columns()
+		if err != nil {
+			return fmt.Errorf(errParseSQLResultSet, err)
+		}
+
+		p.Columns = cols
+
+		if err := ds.inferFields(rows); err != nil {
+			return err
+		}
+
+		order, err := ds.fieldColumns(cols)
+		if err != nil {
+			return err
+		}
+
+		for len(p.Rows) < limit && rows.Next() {
+			raw := make([]interface{}, len(cols))
+			ptrs := make([]interface{}, len(cols))
+
+			for i := range raw {
+				ptrs[i] = &raw[i]
+			}
+
+			if err := rows.Scan(ptrs...); err != nil {
+				return fmt.Errorf(errParseSQLResultSet, err)
+			}
+
+			if order != nil {
+				byField := make([]interface{}, len(ds.Fields))
+
+				for c, f := range order {
+					byField[f] = raw[c]
+				}
+
+				raw = byField
+			}
+
+			p.Rows = append(p.Rows, ds.previewRow(raw))
+		}
+
+		return nil
+	})
 
 	if err != nil {
-		return nil, fmt.Errorf(errFailedSQLQuery, err)
+		return nil, err
 	}
 
-	defer rows.Close()
+	return p, nil
+}
+
+func (ds Dataset) previewRow(raw []interface{}) []PreviewCell {
+	n := len(raw)
+	if len(ds.Fields) > n {
+		n = len(ds.Fields)
+	}
+
+	row := make([]PreviewCell, n)
+
+	for i := range row {
+		switch {
+		case i >= len(ds.Fields):
+			row[i].Err = errors.New(errPreviewNoField)
+		case i >= len(raw):
+			row[i].Err = errors.New(errPreviewNoColumn)
+		default:
+			f := ds.Fields[i]
+			col := f.fieldTypeMapping()
+
+			// This is the same conversion rows.Scan makes for a field
+			if err := col.(sql.Scanner).Scan(raw[i]); err != nil {
+				row[i].Err = err
+				continue
+			}
+
+			row[i].Value = f.value(col)
+			row[i].Err = f.validateValue(row[i].Value)
+		}
+	}
+
+	return row
+}
 
-	for rows.Next() {
-		var rvp []interface{}
-		for _, v := range ds.Fields {
-			rvp = append(rvp, v.fieldTypeMapping())
+// queryDatasource runs the dataset query and passes each row
+// to fn as it is read, with the values in the order of the fields
+func (ds *Dataset) queryDatasource(ctx context.Context, dc *DatabaseConfig, db *sql.DB, fn func([]interface{}) error) error {
+	return ds.query(ctx, dc, db, ds.querySQL(), func(rows *sql.Rows, qt *queryTimer) error {
+		if err := ds.inferFields(rows); err != nil {
+			return err
 		}
 
-		err = rows.Scan(rvp...)
+		cols, err := rows.Columns()
+		if err != nil {
+			return fmt.Errorf(errParseSQLResultSet, err)
+		}
 
+		order, err := ds.fieldColumns(cols)
 		if err != nil {
-			return nil, fmt.Errorf(errParseSQLResultSet, err)
+			return err
+		}
+
+		if order == nil && len(cols) != len(ds.Fields) {
+			return ds.columnCountError(cols)
+		}
+
+		for rows.Next() {
+			var rvp []interface{}
+			for _, v := range ds.Fields {
+				rvp = append(rvp, v.fieldTypeMapping())
+			}
+
+			dest := rvp
+
+			if order != nil {
+				dest = make([]interface{}, len(order))
+
+				for c, f := range order {
+					dest[c] = rvp[f]
+				}
+			}
+
+			err := rows.Scan(dest...)
+
+			if err != nil {
+				return fmt.Errorf(errParseSQLResultSet, err)
+			}
+
+			// Handling the row may send a batch to Geckoboard,
+			// which shouldn't count against the query timeout
+			if err := qt.paused(func() error { return fn(rvp) }); err != nil {
+				return err
+			}
 		}
 
-		records = append(records, rvp)
+		return nil
+	})
+}
+
+// fieldColumns returns the index of the field each query result column maps
+// to, or nil when the fields are matched to the columns by position
+func (ds Dataset) fieldColumns(cols []string) ([]int, error) {
+	if !ds.MapsColumnsByName() {
+		return nil, nil
 	}
 
-	if err = rows.Err(); err != nil {
+	fields := make(map[string]int)
+	for i, f := range ds.Fields {
+		fields[f.Column] = i
+	}
+
+	var (
+		order = make([]int, len(cols))
+		found = make(map[string]bool)
+		errs  []string
+	)
+
+	for c, col := range cols {
+		i, ok := fields[col]
+		if !ok {
+			errs = append(errs, fmt.Sprintf(errUnmappedQueryColumn, col))
+			continue
+		}
+
+		order[c] = i
+		found[col] = true
+	}
+
+	for _, f := range ds.Fields {
+		if !found[f.Column] {
+			errs = append(errs, fmt.Sprintf(errMissingQueryColumn, f.Column, f.Name))
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf(errParseSQLResultSet, strings.Join(errs, " "))
+	}
+
+	return order, nil
+}
+
+// columnCountError describes the mismatch between the
+// fields and the columns returned by the dataset query
+func (ds Dataset) columnCountError(cols []string) error {
+	names := make([]string, len(ds.Fields))
+	for i, f := range ds.Fields {
+		names[i] = f.Name
+	}
+
+	return fmt.Errorf(errColumnCountMismatch, ds.Name, len(cols), len(ds.Fields),
+		strings.Join(names, `", "`), strings.Join(cols, `", "`))
+}
+
+// InferredFields runs the dataset query and returns
+// the fields inferred from its result set columns
+func (ds Dataset) InferredFields(ctx context.Context, dc *DatabaseConfig, db *sql.DB) (fields []Field, err error) {
+	err = ds.query(ctx, dc, db, ds.querySQL(), func(rows *sql.Rows, _ *queryTimer) error {
+		cols, err := rows.ColumnTypes()
+		if err != nil {
+			return fmt.Errorf(errParseSQLResultSet, err)
+		}
+
+		fields = InferFields(cols)
+		return nil
+	})
+
+	if err != nil {
 		return nil, err
 	}
 
-	return records, nil
+	return fields, nil
+}
+
+// inferFields sets the dataset fields from the result set
+// columns when it infers its fields and they aren't set yet
+func (ds *Dataset) inferFields(rows *sql.Rows) error {
+	if !ds.InferFields || len(ds.Fields) > 0 {
+		return nil
+	}
+
+	cols, err := rows.ColumnTypes()
+	if err != nil {
+		return fmt.Errorf(errParseSQLResultSet, err)
+	}
+
+	if len(cols) > MaxFields {
+		return fmt.Errorf(errTooManyFields, len(cols), MaxFields)
+	}
+
+	ds.Fields = InferFields(cols)
+	return nil
+}
+
+// query runs the SQL with the dataset query timeout and passes the rows to
+// fn, errors from running the query are wrapped with errFailedSQLQuery. The
+// timer is passed to fn so time spent handling rows can be left out of it.
+func (ds Dataset) query(ctx context.Context, dc *DatabaseConfig, db *sql.DB, query string, fn func(*sql.Rows, *queryTimer) error) error {
+	timeout := ds.EffectiveQueryTimeout(dc)
+
+	ctx, qt := startQueryTimer(ctx, timeout)
+	defer qt.stop()
+
+	rows, err := db.QueryContext(ctx, query)
+
+	if err != nil {
+		return queryError(ctx, qt, timeout, err)
+	}
+
+	defer rows.Close()
+
+	if err = fn(rows, qt); err != nil {
+		return err
+	}
+
+	if err = rows.Err(); err != nil {
+		return queryError(ctx, qt, timeout, err)
+	}
+
+	return nil
+}
+
+// queryError replaces the driver specific error with a clearer
+// message when the query was stopped by its timeout or cancelled
+func queryError(ctx context.Context, qt *queryTimer, timeout time.Duration, err error) error {
+	switch {
+	case qt.timedOut() || ctx.Err() == context.DeadlineExceeded:
+		return fmt.Errorf(errFailedSQLQuery, fmt.Sprintf(errQueryTimedOut, timeout))
+	case ctx.Err() == context.Canceled:
+		return fmt.Errorf(errFailedSQLQuery, errQueryCancelled)
+	}
+
+	if isConnectionError(err) {
+		return &ConnectionError{Err: fmt.Errorf(errFailedSQLQuery, err)}
+	}
+
+	return fmt.Errorf(errFailedSQLQuery, err)
+}
+
+// ConnectionError is returned when the database couldn't be
+// connected to or the connection was lost, rather than the
+// query itself failing
+type ConnectionError struct {
+	Err error
+}
+
+func (e *ConnectionError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConnectionError) Unwrap() error {
+	return e.Err
+}
+
+func isConnectionError(err error) bool {
+	var netErr net.Error
+
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.As(err, &netErr)
 }
 
 func (f Field) fieldTypeMapping() interface{} {
@@ -110,3 +448,35 @@ func (f Field) fieldTypeMapping() interface{} {
 
 	return nil
 }
+
+// validateValue checks a value converted for the field
+// is within the limits of the Geckoboard Datasets API
+func (f Field) validateValue(v interface{}) error {
+	if s, ok := v.(string); ok {
+		if n := utf8.RuneCountInString(s); n > MaxStringLength {
+			return fmt.Errorf(errStringTooLong, f.Name, n, MaxStringLength)
+		}
+	}
+
+	return nil
+}
+
+// value converts a scanned column into the value sent to Geckoboard
+func (f Field) value(col interface{}) interface{} {
+	switch f.Type {
+	case NumberType, MoneyType, PercentageType, DurationType:
+		return col.(*Number).Value(f.Optional)
+	case StringType:
+		return col.(*null.String).String
+	case DateType:
+		if d := col.(*null.Time); d.Valid {
+			return d.Time.Format(dateFormat)
+		}
+	case DatetimeType:
+		if d := col.(*null.Time); d.Valid {
+			return d.Time.Format(time.RFC3339)
+		}
+	}
+
+	return nil
+}
@@ -1,10 +1,13 @@
 package models
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -85,7 +88,29 @@ func TestBuildDatasetSQLiteDriver(t *testing.T) {
 				},
 				Datasets: []Dataset{
 					{
-						SQL: "SELECT app_name, build_cost, created_at FROM builds GROUP BY app_name order by app_name",
+						Name: "app.builds",
+						SQL:  "SELECT app_name, build_cost, created_at FROM builds GROUP BY app_name order by app_name",
+						Fields: []Field{
+							{Name: "App", Type: StringType},
+							{Name: "Build Count", Type: NumberType},
+						},
+					},
+				},
+			},
+			out: nil,
+			err: `The query for the dataset app.builds returns 3 columns but 2 fields are configured. ` +
+				`Expected columns for the fields "App", "Build Count" but got the columns "app_name", "build_cost", "created_at".`,
+		},
+		{
+			config: Config{
+				DatabaseConfig: &DatabaseConfig{
+					Driver: SQLiteDriver,
+					URL:    "fixtures/db.sqlite",
+				},
+				Datasets: []Dataset{
+					{
+						Name: "app.builds",
+						SQL:  "SELECT app_name FROM builds",
 						Fields: []Field{
 							{Name: "App", Type: StringType},
 							{Name: "Build Count", Type: NumberType},
@@ -94,7 +119,8 @@ func TestBuildDatasetSQLiteDriver(t *testing.T) {
 				},
 			},
 			out: nil,
-			err: fmt.Sprintf(errParseSQLResultSet, "sql: expected 3 destination arguments in Scan, not 2"),
+			err: `The query for the dataset app.builds returns 1 columns but 2 fields are configured. ` +
+				`Expected columns for the fields "App", "Build Count" but got the columns "app_name".`,
 		},
 		{
 			// StringType and Number as an int64
@@ -434,11 +460,94 @@ func TestBuildDatasetSQLiteDriver(t *testing.T) {
 			},
 			out: DatasetRows{},
 		},
+		{
+			// Database query timeout cancels a runaway query
+			config: Config{
+				DatabaseConfig: &DatabaseConfig{
+					Driver:       SQLiteDriver,
+					URL:          "fixtures/db.sqlite",
+					QueryTimeout: 100 * time.Millisecond,
+				},
+				Datasets: []Dataset{
+					{
+						SQL: `WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x+1 FROM c) SELECT count(*) FROM c`,
+						Fields: []Field{
+							{Name: "Count", Type: NumberType},
+						},
+					},
+				},
+			},
+			out: nil,
+			err: fmt.Sprintf(errFailedSQLQuery, "the query timed out after 100ms"),
+		},
+		{
+			// Dataset query timeout overrides the database one
+			config: Config{
+				DatabaseConfig: &DatabaseConfig{
+					Driver:       SQLiteDriver,
+					URL:          "fixtures/db.sqlite",
+					QueryTimeout: time.Hour,
+				},
+				Datasets: []Dataset{
+					{
+						SQL:          `WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x+1 FROM c) SELECT count(*) FROM c`,
+						QueryTimeout: 50 * time.Millisecond,
+						Fields: []Field{
+							{Name: "Count", Type: NumberType},
+						},
+					},
+				},
+			},
+			out: nil,
+			err: fmt.Sprintf(errFailedSQLQuery, "the query timed out after 50ms"),
+		},
+		{
+			// Fields map to columns by name whatever the SELECT order
+			config: Config{
+				DatabaseConfig: &DatabaseConfig{
+					Driver: SQLiteDriver,
+					URL:    "fixtures/db.sqlite",
+				},
+				Datasets: []Dataset{
+					{
+						SQL: "SELECT build_cost AS cost, app_name FROM builds WHERE id IN (6, 7) ORDER BY id",
+						Fields: []Field{
+							{Name: "App", Type: StringType, Column: "app_name"},
+							{Name: "Cost", Type: NumberType, Column: "cost", Optional: true},
+						},
+					},
+				},
+			},
+			out: []map[string]interface{}{
+				{"app": "westworld", "cost": 2.64},
+				{"app": "geckoboard-ruby", "cost": nil},
+			},
+		},
+		{
+			config: Config{
+				DatabaseConfig: &DatabaseConfig{
+					Driver: SQLiteDriver,
+					URL:    "fixtures/db.sqlite",
+				},
+				Datasets: []Dataset{
+					{
+						SQL: "SELECT app_name, run_time FROM builds",
+						Fields: []Field{
+							{Name: "App", Type: StringType, Column: "app_name"},
+							{Name: "Cost", Type: NumberType, Column: "build_cost"},
+						},
+					},
+				},
+			},
+			out: nil,
+			err: fmt.Sprintf(errParseSQLResultSet, `The column "run_time" in the query results is not mapped to a field. `+
+				`The column "build_cost" for the field "Cost" is not in the query results.`),
+		},
 	}
 
 	for idx, tc := range testCases {
 		db := NewDBConnection(t, tc.config.DatabaseConfig.Driver, tc.config.DatabaseConfig.URL)
-		out, err := tc.config.Datasets[0].BuildDataset(tc.config.DatabaseConfig, db)
+		out, err := tc.config.Datasets[0].BuildDataset(context.Background(), tc.config.DatabaseConfig, db)
 
 		if tc.err == "" && err != nil {
 			t.Errorf("[%d] Expected no error but got %s", idx, err)
@@ -467,6 +576,44 @@ func TestBuildDatasetSQLiteDriver(t *testing.T) {
 	}
 }
 
+func TestPreviewDatasetSQLiteDriver(t *testing.T) {
+	dc := &DatabaseConfig{Driver: SQLiteDriver, URL: "fixtures/db.sqlite"}
+	db := NewDBConnection(t, dc.Driver, dc.URL)
+
+	ds := Dataset{
+		SQL: "SELECT app_name, build_cost FROM builds WHERE id IN (6, 7) ORDER BY id",
+		Fields: []Field{
+			{Name: "App", Type: StringType},
+			{Name: "Build cost", Type: MoneyType, Optional: true},
+			{Name: "Run time", Type: NumberType},
+		},
+	}
+
+	p, err := ds.PreviewDataset(context.Background(), dc, db, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cols := strings.Join(p.Columns, ","); cols != "app_name,build_cost" {
+		t.Errorf("Expected columns app_name,build_cost but got %s", cols)
+	}
+
+	exp := [][]PreviewCell{
+		{{Value: "westworld"}, {Value: 2.64}, {Err: errors.New(errPreviewNoColumn)}},
+		{{Value: "geckoboard-ruby"}, {Value: nil}, {Err: errors.New(errPreviewNoColumn)}},
+	}
+
+	if !reflect.DeepEqual(p.Rows, exp) {
+		t.Errorf("Expected rows %#v but got %#v", exp, p.Rows)
+	}
+
+	ds.SQL = "SELECT app_name FROM missing_table"
+
+	if _, err := ds.PreviewDataset(context.Background(), dc, db, 5); err == nil || err.Error() != fmt.Sprintf(errFailedSQLQuery, "no such table: missing_table") {
+		t.Errorf("Expected query error but got %v", err)
+	}
+}
+
 func TestBuildDatasetPostgresDriver(t *testing.T) {
 	// Setup the postgres and run the insert
 	env, ok := os.LookupEnv("POSTGRES_URL")
@@ -894,7 +1041,7 @@ func TestBuildDatasetPostgresDriver(t *testing.T) {
 
 	for idx, tc := range testCases {
 		db := NewDBConnection(t, tc.config.DatabaseConfig.Driver, tc.config.DatabaseConfig.URL)
-		out, err := tc.config.Datasets[0].BuildDataset(tc.config.DatabaseConfig, db)
+		out, err := tc.config.Datasets[0].BuildDataset(context.Background(), tc.config.DatabaseConfig, db)
 
 		if tc.err == "" && err != nil {
 			t.Errorf("[%d] Expected no error but got %s", idx, err)
@@ -1350,7 +1497,7 @@ func TestBuildDatasetMySQLDriver(t *testing.T) {
 
 	for idx, tc := range testCases {
 		db := NewDBConnection(t, tc.config.DatabaseConfig.Driver, tc.config.DatabaseConfig.URL)
-		out, err := tc.config.Datasets[0].BuildDataset(tc.config.DatabaseConfig, db)
+		out, err := tc.config.Datasets[0].BuildDataset(context.Background(), tc.config.DatabaseConfig, db)
 
 		if tc.err == "" && err != nil {
 			t.Errorf("[%d] Expected no error but got %s", idx, err)
@@ -1805,7 +1952,7 @@ func TestBuildDatasetMSSQLDriver(t *testing.T) {
 
 	for idx, tc := range testCases {
 		db := NewDBConnection(t, tc.config.DatabaseConfig.Driver, tc.config.DatabaseConfig.URL)
-		out, err := tc.config.Datasets[0].BuildDataset(tc.config.DatabaseConfig, db)
+		out, err := tc.config.Datasets[0].BuildDataset(context.Background(), tc.config.DatabaseConfig, db)
 
 		if tc.err == "" && err != nil {
 			t.Errorf("[%d] Expected no error but got %s", idx, err)
@@ -1854,3 +2001,329 @@ func NewDBConnection(t *testing.T, driver, url string) *sql.DB {
 
 	return pool
 }
+
+func TestInferFieldsSQLiteDriver(t *testing.T) {
+	dc := &DatabaseConfig{Driver: SQLiteDriver, URL: "fixtures/db.sqlite"}
+	db := NewDBConnection(t, dc.Driver, dc.URL)
+
+	ds := Dataset{
+		SQL:         "SELECT app_name, build_cost, percent_passed, created_at, date(created_at) AS day, COUNT(*) AS total FROM builds WHERE id = 6",
+		InferFields: true,
+	}
+
+	fields, err := ds.InferredFields(context.Background(), dc, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []Field{
+		{Name: "app_name", Type: StringType},
+		{Name: "build_cost", Type: NumberType, Optional: true},
+		{Name: "percent_passed", Type: NumberType, Optional: true},
+		{Name: "created_at", Type: DatetimeType},
+		{Name: "day", Type: StringType},
+		// SQLite has no type for expressions
+		{Name: "total", Type: StringType},
+	}
+
+	if !reflect.DeepEqual(fields, exp) {
+		t.Errorf("Expected fields %#v but got %#v", exp, fields)
+	}
+
+	ds.SQL = "SELECT app_name, build_cost FROM builds WHERE id = 6"
+
+	out, err := ds.BuildDataset(context.Background(), dc, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ds.Fields) != 2 {
+		t.Errorf("Expected BuildDataset to set 2 inferred fields but got %d", len(ds.Fields))
+	}
+
+	expRows := DatasetRows{{"appname": "westworld", "buildcost": 2.64}}
+
+	if !reflect.DeepEqual(out, expRows) {
+		t.Errorf("Expected rows %#v but got %#v", expRows, out)
+	}
+}
+
+func TestStreamDatasetSQLiteDriver(t *testing.T) {
+	dc := &DatabaseConfig{Driver: SQLiteDriver, URL: "fixtures/db.sqlite"}
+	db := NewDBConnection(t, dc.Driver, dc.URL)
+
+	testCases := []struct {
+		dataset Dataset
+		size    int
+		batches []int
+		err     string
+	}{
+		{
+			dataset: Dataset{
+				UpdateType: Append,
+				SQL:        "SELECT app_name FROM builds",
+				Fields:     []Field{{Name: "App", Type: StringType}},
+			},
+			size:    4,
+			batches: []int{4, 4, 1},
+		},
+		{
+			dataset: Dataset{
+				UpdateType: Append,
+				SQL:        "SELECT app_name FROM builds LIMIT 8",
+				Fields:     []Field{{Name: "App", Type: StringType}},
+			},
+			size:    4,
+			batches: []int{4, 4},
+		},
+		{
+			dataset: Dataset{
+				UpdateType: Append,
+				SQL:        "SELECT app_name FROM builds WHERE id < 0",
+				Fields:     []Field{{Name: "App", Type: StringType}},
+			},
+			size:    4,
+			batches: []int{0},
+		},
+		{
+			dataset: Dataset{
+				UpdateType: Append,
+				SQL:        "SELECT app_name FROM builds",
+				Fields:     []Field{{Name: "App", Type: StringType}},
+			},
+			batches: []int{9},
+		},
+		{
+			// Strings can be as long as the API allows
+			dataset: Dataset{
+				UpdateType: Append,
+				SQL:        "SELECT substr(hex(zeroblob(50)), 1, 100)",
+				Fields:     []Field{{Name: "App", Type: StringType}},
+			},
+			batches: []int{1},
+		},
+		{
+			// But a longer one stops the update
+			dataset: Dataset{
+				Name:       "apps",
+				UpdateType: Append,
+				SQL:        "SELECT app_name FROM builds UNION ALL SELECT substr(hex(zeroblob(51)), 1, 101)",
+				Fields:     []Field{{Name: "App", Type: StringType}},
+			},
+			size:    4,
+			batches: []int{4, 4},
+			err:     fmt.Sprintf(errInvalidRecord, 10, "apps", fmt.Sprintf(errStringTooLong, "App", 101, MaxStringLength)),
+		},
+		{
+			// A replace stops reading as soon as it has too many records
+			dataset: Dataset{
+				Name:       "numbers",
+				UpdateType: Replace,
+				SQL:        "WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x+1 FROM c WHERE x < 10000) SELECT x FROM c",
+				Fields:     []Field{{Name: "Number", Type: NumberType}},
+			},
+			batches: nil,
+			err:     fmt.Sprintf(errTooManyRecords, MaxRecords, "numbers"),
+		},
+	}
+
+	for i, tc := range testCases {
+		var batches []int
+
+		err := tc.dataset.StreamDataset(context.Background(), dc, db, tc.size, func(batch DatasetRows, _ string) error {
+			batches = append(batches, len(batch))
+			return nil
+		})
+
+		switch {
+		case err == nil && tc.err != "":
+			t.Errorf("[%d] Expected error %s but got none", i, tc.err)
+		case err != nil && err.Error() != tc.err:
+			t.Errorf("[%d] Expected error %s but got %s", i, tc.err, err)
+		}
+
+		if !reflect.DeepEqual(batches, tc.batches) {
+			t.Errorf("[%d] Expected batches %v but got %v", i, tc.batches, batches)
+		}
+	}
+
+	// An error handling a batch stops the query
+	ds := Dataset{
+		UpdateType: Append,
+		SQL:        "SELECT app_name FROM builds",
+		Fields:     []Field{{Name: "App", Type: StringType}},
+	}
+
+	calls := 0
+
+	err := ds.StreamDataset(context.Background(), dc, db, 2, func(batch DatasetRows, _ string) error {
+		calls++
+		return errors.New("send failed")
+	})
+
+	if err == nil || err.Error() != "send failed" || calls != 1 {
+		t.Errorf("Expected the first batch error to stop streaming but got %v after %d calls", err, calls)
+	}
+}
+
+func TestStreamDatasetTimeoutExcludesSending(t *testing.T) {
+	dc := &DatabaseConfig{Driver: SQLiteDriver, URL: "fixtures/db.sqlite"}
+	db := NewDBConnection(t, dc.Driver, dc.URL)
+
+	ds := Dataset{
+		UpdateType:   Append,
+		SQL:          "SELECT app_name FROM builds",
+		QueryTimeout: 50 * time.Millisecond,
+		Fields:       []Field{{Name: "App", Type: StringType}},
+	}
+
+	var batches []int
+
+	// Sending the batches takes far longer than the query timeout
+	err := ds.StreamDataset(context.Background(), dc, db, 2, func(batch DatasetRows, _ string) error {
+		batches = append(batches, len(batch))
+		time.Sleep(30 * time.Millisecond)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Expected slow sends not to time out the query but got %s", err)
+	}
+
+	if exp := []int{2, 2, 2, 2, 1}; !reflect.DeepEqual(batches, exp) {
+		t.Errorf("Expected batches %v but got %v", exp, batches)
+	}
+}
+
+func TestStreamDatasetConnectionError(t *testing.T) {
+	ds := Dataset{
+		UpdateType: Replace,
+		SQL:        "SELECT app_name FROM builds",
+		Fields:     []Field{{Name: "App", Type: StringType}},
+	}
+
+	fn := func(DatasetRows, string) error { return nil }
+
+	// Nothing listens on the port so the connection is refused
+	dc := &DatabaseConfig{Driver: PostgresDriver, URL: "postgres://user@127.0.0.1:9999/db?sslmode=disable"}
+
+	db, err := sql.Open(dc.Driver, dc.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	var connErr *ConnectionError
+
+	if err := ds.StreamDataset(context.Background(), dc, db, 0, fn); !errors.As(err, &connErr) {
+		t.Errorf("Expected a connection error but got %v", err)
+	}
+
+	// A failing query on a working connection isn't a connection error
+	dc = &DatabaseConfig{Driver: SQLiteDriver, URL: "fixtures/db.sqlite"}
+	ds.SQL = "SELECT app_name FROM missing_table"
+
+	err = ds.StreamDataset(context.Background(), dc, NewDBConnection(t, dc.Driver, dc.URL), 0, fn)
+	if err == nil || errors.As(err, &connErr) {
+		t.Errorf("Expected a query error but got %v", err)
+	}
+}
+
+func TestStreamDatasetCursorValue(t *testing.T) {
+	dc := &DatabaseConfig{Driver: SQLiteDriver, URL: ":memory:"}
+	db := NewDBConnection(t, dc.Driver, dc.URL)
+
+	// Each connection to :memory: is its own database
+	db.SetMaxOpenConns(1)
+
+	_, err := db.Exec(`CREATE TABLE orders (id INTEGER, created_at TIMESTAMP);
+		INSERT INTO orders VALUES
+			(1, '2017-03-21 11:12:00.25'),
+			(2, '2017-03-21 11:12:00.75'),
+			(3, '2017-03-21 11:12:01.5'),
+			(4, '2017-03-21 11:11:59')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ds := Dataset{
+		UpdateType:   Append,
+		SQL:          "SELECT id, created_at FROM orders WHERE {{ last_value }} IS NOT NULL ORDER BY id",
+		CursorColumn: "created_at",
+		InitialValue: "2017-01-01",
+		LastValue:    "2017-03-21T11:12:00Z",
+		Fields: []Field{
+			{Name: "ID", Type: NumberType},
+			{Name: "Created at", Type: DatetimeType},
+		},
+	}
+
+	var (
+		sent       []interface{}
+		lastValues []string
+	)
+
+	err = ds.StreamDataset(context.Background(), dc, db, 2, func(batch DatasetRows, lastValue string) error {
+		for _, row := range batch {
+			sent = append(sent, row["created_at"])
+		}
+
+		lastValues = append(lastValues, lastValue)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Geckoboard is sent whole seconds but the cursor keeps the fraction
+	expSent := []interface{}{"2017-03-21T11:12:00Z", "2017-03-21T11:12:00Z", "2017-03-21T11:12:01Z", "2017-03-21T11:11:59Z"}
+	expLast := []string{"2017-03-21T11:12:00.75Z", "2017-03-21T11:12:01.5Z"}
+
+	if !reflect.DeepEqual(sent, expSent) {
+		t.Errorf("Expected values sent %v but got %v", expSent, sent)
+	}
+
+	if !reflect.DeepEqual(lastValues, expLast) {
+		t.Errorf("Expected last values %v but got %v", expLast, lastValues)
+	}
+}
+
+func TestBuildDeletionsSQLiteDriver(t *testing.T) {
+	dc := &DatabaseConfig{Driver: SQLiteDriver, URL: "fixtures/db.sqlite"}
+	db := NewDBConnection(t, dc.Driver, dc.URL)
+
+	ds := Dataset{
+		Name:       "app.builds",
+		UpdateType: Append,
+		SQL:        "SELECT id, app_name FROM builds",
+		DeleteSQL:  "SELECT id, app_name FROM builds WHERE app_name = '' ORDER BY id",
+		UniqueBy:   []string{"ID", "app"},
+		Fields: []Field{
+			{Name: "ID", Type: NumberType},
+			{Name: "App", Type: StringType},
+		},
+	}
+
+	out, err := ds.BuildDeletions(context.Background(), dc, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := DatasetRows{
+		{"id": int64(8), "app": ""},
+		{"id": int64(9), "app": ""},
+	}
+
+	if !reflect.DeepEqual(out, exp) {
+		t.Errorf("Expected deletions %#v but got %#v", exp, out)
+	}
+
+	ds.DeleteSQL = "SELECT id FROM builds WHERE app_name = ''"
+
+	if _, err := ds.BuildDeletions(context.Background(), dc, db); err == nil ||
+		err.Error() != `The delete_sql for the dataset app.builds returns 1 columns but there are 2 unique_by fields "ID", "app".` {
+		t.Errorf("Expected column count error but got %v", err)
+	}
+}
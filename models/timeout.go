@@ -0,0 +1,73 @@
+package models
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// queryTimer cancels a query once it has run for its timeout. The time spent
+// handling its rows isn't counted, so sending them to Geckoboard while they
+// are still being read doesn't use up the time the query itself is given.
+type queryTimer struct {
+	mu        sync.Mutex
+	cancel    context.CancelFunc
+	timer     *time.Timer
+	remaining time.Duration
+	resumed   time.Time
+	expired   bool
+}
+
+// startQueryTimer returns a context which is cancelled once the timeout
+// is used up, a timeout of zero means the query is never cancelled
+func startQueryTimer(ctx context.Context, timeout time.Duration) (context.Context, *queryTimer) {
+	ctx, cancel := context.WithCancel(ctx)
+	qt := &queryTimer{cancel: cancel, remaining: timeout, resumed: time.Now()}
+
+	if timeout > 0 {
+		qt.timer = time.AfterFunc(timeout, qt.expire)
+	}
+
+	return ctx, qt
+}
+
+func (qt *queryTimer) expire() {
+	qt.mu.Lock()
+	qt.expired = true
+	qt.mu.Unlock()
+
+	qt.cancel()
+}
+
+// paused runs fn with the timer stopped
+func (qt *queryTimer) paused(fn func() error) error {
+	if qt.timer == nil || !qt.timer.Stop() {
+		return fn()
+	}
+
+	qt.remaining -= time.Since(qt.resumed)
+
+	err := fn()
+
+	qt.resumed = time.Now()
+	qt.timer.Reset(qt.remaining)
+
+	return err
+}
+
+// timedOut reports whether the query was cancelled by the timer
+func (qt *queryTimer) timedOut() bool {
+	qt.mu.Lock()
+	defer qt.mu.Unlock()
+
+	return qt.expired
+}
+
+// stop releases the timer and the context once the query is done
+func (qt *queryTimer) stop() {
+	if qt.timer != nil {
+		qt.timer.Stop()
+	}
+
+	qt.cancel()
+}
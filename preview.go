@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/geckoboard/sql-dataset/models"
+)
+
+const maxPreviewCellWidth = 40
+
+// previewDataset runs the query for the named dataset and
+// prints its first rows as a table, without sending anything
+func previewDataset(w io.Writer, name string, limit int, config *models.Config) error {
+	ds, dc, db, err := openDatasetDatabase(name, config)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	p, err := ds.PreviewDataset(context.Background(), dc, db, limit)
+	if err != nil {
+		return err
+	}
+
+	printPreview(w, ds, p)
+	return nil
+}
+
+// openDatasetDatabase finds the named dataset in the config
+// and opens a connection to the database it queries
+func openDatasetDatabase(name string, config *models.Config) (models.Dataset, *models.DatabaseConfig, *sql.DB, error) {
+	for _, ds := range config.Datasets {
+		if ds.Name != name {
+			continue
+		}
+
+		_, dc, err := config.DatabaseFor(ds)
+		if err != nil {
+			return ds, nil, nil, &configError{err}
+		}
+
+		db, err := openDatabase(dc)
+		return ds, dc, db, err
+	}
+
+	return models.Dataset{}, nil, nil, &configError{fmt.Errorf("No dataset named %q found in the config", name)}
+}
+
+// printPreview writes an aligned table of the preview with a header of the
+// field names and types. Cells which failed to convert are marked with a
+// reference to their error which is listed below the table.
+func printPreview(w io.Writer, ds models.Dataset, p *models.Preview) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	cols := len(p.Columns)
+	if len(ds.Fields) > cols {
+		cols = len(ds.Fields)
+	}
+
+	names := make([]string, cols)
+	types := make([]string, cols)
+	lines := make([]string, cols)
+
+	for i := range names {
+		if i < len(ds.Fields) {
+			names[i] = ds.Fields[i].Name
+			types[i] = string(ds.Fields[i].Type)
+		} else {
+			names[i] = p.Columns[i]
+			types[i] = "-"
+		}
+
+		lines[i] = strings.Repeat("-", len(names[i]))
+	}
+
+	fmt.Fprintln(tw, strings.Join(names, "\t"))
+	fmt.Fprintln(tw, strings.Join(types, "\t"))
+	fmt.Fprintln(tw, strings.Join(lines, "\t"))
+
+	var errs []string
+
+	for r, row := range p.Rows {
+		cells := make([]string, len(row))
+
+		for c, cell := range row {
+			if cell.Err != nil {
+				errs = append(errs, fmt.Sprintf("[%d] row %d, %s: %s", len(errs)+1, r+1, names[c], cell.Err))
+				cells[c] = fmt.Sprintf("ERROR [%d]", len(errs))
+				continue
+			}
+
+			cells[c] = formatPreviewValue(cell.Value)
+		}
+
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+
+	tw.Flush()
+
+	fmt.Fprintf(w, "\n%d rows shown\n", len(p.Rows))
+
+	if len(errs) > 0 {
+		fmt.Fprintf(w, "\n%d values could not be converted to their field type:\n", len(errs))
+
+		for _, e := range errs {
+			fmt.Fprintln(w, e)
+		}
+	}
+}
+
+func formatPreviewValue(v interface{}) string {
+	if v == nil {
+		return "NULL"
+	}
+
+	s := strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(fmt.Sprint(v))
+
+	// Cut by character so a multi-byte character isn't split
+	if r := []rune(s); len(r) > maxPreviewCellWidth {
+		s = string(r[:maxPreviewCellWidth-3]) + "..."
+	}
+
+	return s
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/geckoboard/sql-dataset/models"
+)
+
+func TestPreviewDataset(t *testing.T) {
+	config := models.Config{
+		DatabaseConfig: &models.DatabaseConfig{
+			Driver:   models.SQLiteDriver,
+			Database: filepath.Join("models", "fixtures", "db.sqlite"),
+		},
+		Datasets: []models.Dataset{
+			{
+				Name: "app.builds",
+				SQL:  "SELECT app_name, triggered_by, percent_passed, created_at FROM builds ORDER BY id",
+				Fields: []models.Field{
+					{Name: "App", Type: models.StringType},
+					{Name: "Triggered by", Type: models.NumberType},
+					{Name: "Percent passed", Type: models.PercentageType, Optional: true},
+				},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+
+	if err := previewDataset(&buf, "app.builds", 3, &config); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `App              Triggered by  Percent passed  created_at
+string           number        percentage      -
+---              ------------  --------------  ----------
+everdeen         ERROR [1]     80              ERROR [2]
+react            ERROR [3]     95              ERROR [4]
+geckoboard-ruby  ERROR [5]     24              ERROR [6]
+
+3 rows shown
+
+6 values could not be converted to their field type:
+[1] row 1, Triggered by: can't convert string "maeve millay" to number
+[2] row 1, created_at: no field for this column
+[3] row 2, Triggered by: can't convert string "dr.robert ford" to number
+[4] row 2, created_at: no field for this column
+[5] row 3, Triggered by: can't convert string "maeve millay" to number
+[6] row 3, created_at: no field for this column
+`
+
+	if buf.String() != exp {
+		t.Errorf("Expected preview\n%s\nbut got\n%s", exp, buf.String())
+	}
+
+	if err := previewDataset(&buf, "app.missing", 3, &config); err == nil || err.Error() != `No dataset named "app.missing" found in the config` {
+		t.Errorf("Expected missing dataset error but got %v", err)
+	}
+}
+
+func TestFormatPreviewValue(t *testing.T) {
+	testCases := []struct {
+		in  interface{}
+		out string
+	}{
+		{nil, "NULL"},
+		{int64(42), "42"},
+		{1.5, "1.5"},
+		{"multi\nline\tvalue", "multi line value"},
+		{"a very long string value which will not fit in the column", "a very long string value which will n..."},
+		{"ünïcödé välüés which are counted by character not by byte", "ünïcödé välüés which are counted by c..."},
+		{"ünïcödé välüés which fit in the column", "ünïcödé välüés which fit in the column"},
+	}
+
+	for _, tc := range testCases {
+		if out := formatPreviewValue(tc.in); out != tc.out {
+			t.Errorf("Expected %v to be formatted as %q but got %q", tc.in, tc.out, out)
+		}
+	}
+}
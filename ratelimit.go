@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/geckoboard/sql-dataset/models"
+)
+
+// rateLimiter is a token bucket shared by every request a client makes,
+// so datasets and batches sent concurrently stay under the account limit
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	burst    float64
+	tokens   float64
+	last     time.Time
+	now      func() time.Time
+}
+
+// newRateLimiter returns nil when no rate limit is configured
+func newRateLimiter(rl *models.RateLimitConfig) *rateLimiter {
+	if rl == nil {
+		return nil
+	}
+
+	perSec := rl.RequestsPerSecond
+	if rl.RequestsPerMinute > 0 {
+		perSec = rl.RequestsPerMinute / 60
+	}
+
+	if perSec <= 0 {
+		return nil
+	}
+
+	burst := float64(rl.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &rateLimiter{
+		interval: time.Duration(float64(time.Second) / perSec),
+		burst:    burst,
+		tokens:   burst,
+		now:      time.Now,
+	}
+}
+
+// Wait blocks until a request may be made or ctx is done
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	wait := l.reserve()
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		l.cancel()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// reserve takes a token, returning how long to wait until it is available
+func (l *rateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+
+	if !l.last.IsZero() {
+		l.tokens += float64(now.Sub(l.last)) / float64(l.interval)
+
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+
+	l.last = now
+	l.tokens--
+
+	if l.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-l.tokens * float64(l.interval))
+}
+
+// cancel returns a token which was reserved but not used
+func (l *rateLimiter) cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tokens++
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/geckoboard/sql-dataset/models"
+)
+
+func TestNewRateLimiter(t *testing.T) {
+	testCases := []struct {
+		config   *models.RateLimitConfig
+		interval time.Duration
+		burst    float64
+	}{
+		{nil, 0, 0},
+		{&models.RateLimitConfig{}, 0, 0},
+		{&models.RateLimitConfig{RequestsPerSecond: 4}, 250 * time.Millisecond, 1},
+		{&models.RateLimitConfig{RequestsPerMinute: 30, Burst: 5}, 2 * time.Second, 5},
+	}
+
+	for i, tc := range testCases {
+		l := newRateLimiter(tc.config)
+
+		if tc.interval == 0 {
+			if l != nil {
+				t.Errorf("[%d] Expected no rate limiter but got %#v", i, l)
+			}
+
+			continue
+		}
+
+		if l.interval != tc.interval || l.burst != tc.burst {
+			t.Errorf("[%d] Expected interval %s and burst %.0f but got %s and %.0f", i, tc.interval, tc.burst, l.interval, l.burst)
+		}
+	}
+}
+
+func TestRateLimiterReserve(t *testing.T) {
+	now := time.Date(2021, time.March, 10, 14, 23, 45, 0, time.UTC)
+
+	l := newRateLimiter(&models.RateLimitConfig{RequestsPerSecond: 2, Burst: 2})
+	l.now = func() time.Time { return now }
+
+	// The burst is available straight away then each request queues behind the last
+	expWaits := []time.Duration{0, 0, 500 * time.Millisecond, time.Second}
+
+	for i, exp := range expWaits {
+		if wait := l.reserve(); wait != exp {
+			t.Errorf("[%d] Expected to wait %s but got %s", i, exp, wait)
+		}
+	}
+
+	// Tokens refill over time but never beyond the burst
+	now = now.Add(time.Minute)
+
+	for i, exp := range []time.Duration{0, 0, 500 * time.Millisecond} {
+		if wait := l.reserve(); wait != exp {
+			t.Errorf("[%d] Expected to wait %s after refilling but got %s", i, exp, wait)
+		}
+	}
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	var l *rateLimiter
+
+	if err := l.Wait(context.Background()); err != nil {
+		t.Errorf("Expected no limit without a rate limiter but got %s", err)
+	}
+
+	l = newRateLimiter(&models.RateLimitConfig{RequestsPerMinute: 1})
+
+	if err := l.Wait(context.Background()); err != nil {
+		t.Errorf("Expected first request to be allowed but got %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := l.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected waiting to stop when cancelled but got %v", err)
+	}
+}
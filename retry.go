@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/geckoboard/sql-dataset/models"
+)
+
+const (
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = 30 * time.Second
+)
+
+// retryPolicy controls how failed requests to Geckoboard are retried,
+// by default requests are not retried
+type retryPolicy struct {
+	maxRetries     int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+func newRetryPolicy(rc *models.RetryConfig) retryPolicy {
+	if rc == nil {
+		return retryPolicy{}
+	}
+
+	p := retryPolicy{
+		maxRetries:     int(rc.MaxRetries),
+		initialBackoff: rc.InitialBackoff,
+		maxBackoff:     rc.MaxBackoff,
+	}
+
+	if p.initialBackoff == 0 {
+		p.initialBackoff = defaultInitialBackoff
+	}
+
+	if p.maxBackoff == 0 {
+		p.maxBackoff = defaultMaxBackoff
+	}
+
+	return p
+}
+
+// backoff returns how long to wait before the next retry, doubling each
+// attempt up to the max backoff with jitter so concurrent datasets don't
+// retry in lockstep. A longer Retry-After from the server takes precedence.
+func (p retryPolicy) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	wait := p.initialBackoff << uint(attempt)
+
+	if wait > p.maxBackoff || wait <= 0 {
+		wait = p.maxBackoff
+	}
+
+	wait = wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+
+	if retryAfter > wait {
+		return retryAfter
+	}
+
+	return wait
+}
+
+// doRequest makes the request once the rate limit allows and handles the
+// response, decoding it into out when given. Network errors, 5xx and 429
+// responses are retried for as long as the retry policy allows.
+func (c *Client) doRequest(ctx context.Context, method, path string, body, out interface{}) error {
+	for attempt := 0; ; attempt++ {
+		if err := c.limit.Wait(ctx); err != nil {
+			return err
+		}
+
+		started := time.Now()
+		resp, err := c.makeRequest(ctx, method, path, body)
+		retryAfter, reason, retry := shouldRetry(resp, err)
+
+		if !retry || attempt >= c.retry.maxRetries || ctx.Err() != nil {
+			if err == nil {
+				defer resp.Body.Close()
+				err = handleResponse(resp, out)
+			}
+
+			logRequest(method, path, resp, started, err)
+			return err
+		}
+
+		if resp != nil {
+			// Drain the body so the connection can be reused
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		wait := c.retry.backoff(attempt, retryAfter)
+		logs.warn(fmt.Sprintf("Retrying %s %s in %s (retry %d of %d) after %s",
+			method, path, wait.Round(time.Millisecond), attempt+1, c.retry.maxRetries, reason),
+			fields{"phase": "request", "method": method, "path": path, "retry": attempt + 1, "wait_ms": wait.Milliseconds(), "reason": reason})
+
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// logRequest logs the outcome of the final attempt at a request at debug
+// level, failures are reported by whatever made the request
+func logRequest(method, path string, resp *http.Response, started time.Time, err error) {
+	f := fields{
+		"phase":       "request",
+		"method":      method,
+		"path":        path,
+		"duration_ms": time.Since(started).Milliseconds(),
+	}
+
+	if resp != nil {
+		f["status"] = resp.StatusCode
+	}
+
+	if err != nil {
+		f["error"] = err
+	}
+
+	logs.debug(fmt.Sprintf("%s %s", method, path), f)
+}
+
+// shouldRetry reports whether a request is worth retrying along with the
+// reason and any delay the server asked for with Retry-After
+func shouldRetry(resp *http.Response, err error) (time.Duration, string, bool) {
+	if err != nil {
+		var urlErr *url.Error
+
+		// Only errors from making the request, not building it
+		if errors.As(err, &urlErr) {
+			return 0, err.Error(), true
+		}
+
+		return 0, "", false
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()), resp.Status, true
+	}
+
+	return 0, "", false
+}
+
+// parseRetryAfter converts a Retry-After header given
+// in either seconds or as a HTTP date into a duration
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+
+	return 0
+}
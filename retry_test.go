@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/geckoboard/sql-dataset/models"
+)
+
+func TestDeleteDatasetRetries(t *testing.T) {
+	testCases := []struct {
+		maxRetries uint8
+		responses  []response
+		retryAfter string
+		err        string
+	}{
+		{
+			// Retries disabled by default
+			responses: []response{{code: 503}},
+			err:       errUnexpectedResponse.Error(),
+		},
+		{
+			maxRetries: 3,
+			responses:  []response{{code: 502}, {code: 503}, {code: 200, body: `{}`}},
+		},
+		{
+			maxRetries: 2,
+			responses:  []response{{code: 500}, {code: 500}, {code: 500}},
+			err:        errUnexpectedResponse.Error(),
+		},
+		{
+			maxRetries: 2,
+			responses:  []response{{code: 429}, {code: 200, body: `{}`}},
+			retryAfter: "0",
+		},
+		{
+			// Client errors are never retried
+			maxRetries: 3,
+			responses:  []response{{code: 404, body: `{"error":{"message":"Dataset not found"}}`}},
+			err:        fmt.Sprintf(errInvalidPayload, "Dataset not found"),
+		},
+	}
+
+	for i, tc := range testCases {
+		reqCount := 0
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			resp := tc.responses[reqCount]
+			reqCount++
+
+			if tc.retryAfter != "" {
+				w.Header().Set("Retry-After", tc.retryAfter)
+			}
+
+			w.WriteHeader(resp.code)
+			fmt.Fprintf(w, resp.body)
+		}))
+
+		gbHost = server.URL
+
+		c := NewClient(apiKey)
+		c.retry = newRetryPolicy(&models.RetryConfig{
+			MaxRetries:     tc.maxRetries,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     5 * time.Millisecond,
+		})
+
+		err := c.DeleteDataset(context.Background(), "active.users.count")
+
+		switch {
+		case err == nil && tc.err != "":
+			t.Errorf("[%d] Expected error %q but got none", i, tc.err)
+		case err != nil && tc.err != err.Error():
+			t.Errorf("[%d] Expected error '%s' but got '%s'", i, tc.err, err)
+		}
+
+		if reqCount != len(tc.responses) {
+			t.Errorf("[%d] Expected %d requests but got %d", i, len(tc.responses), reqCount)
+		}
+
+		server.Close()
+	}
+}
+
+func TestRetryNetworkErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	gbHost = server.URL
+	server.Close()
+
+	c := NewClient(apiKey)
+	c.retry = retryPolicy{maxRetries: 1, initialBackoff: time.Millisecond, maxBackoff: time.Millisecond}
+
+	start := time.Now()
+	if err := c.DeleteDataset(context.Background(), "active.users.count"); err == nil {
+		t.Error("Expected connection error but got none")
+	}
+
+	// Cancelling stops waiting on the backoff
+	c.retry = retryPolicy{maxRetries: 1, initialBackoff: time.Hour, maxBackoff: time.Hour}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := c.DeleteDataset(ctx, "active.users.count"); err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline exceeded error but got %v", err)
+	}
+
+	if time.Since(start) > 5*time.Second {
+		t.Error("Expected retries to give up promptly")
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := newRetryPolicy(&models.RetryConfig{MaxRetries: 5})
+
+	if p.initialBackoff != defaultInitialBackoff || p.maxBackoff != defaultMaxBackoff {
+		t.Errorf("Expected default backoffs but got %s and %s", p.initialBackoff, p.maxBackoff)
+	}
+
+	testCases := []struct {
+		attempt    int
+		retryAfter time.Duration
+		min, max   time.Duration
+	}{
+		{0, 0, 500 * time.Millisecond, time.Second},
+		{1, 0, time.Second, 2 * time.Second},
+		{3, 0, 4 * time.Second, 8 * time.Second},
+		{10, 0, 15 * time.Second, 30 * time.Second},
+		{100, 0, 15 * time.Second, 30 * time.Second},
+		{0, time.Minute, time.Minute, time.Minute},
+	}
+
+	for i, tc := range testCases {
+		wait := p.backoff(tc.attempt, tc.retryAfter)
+
+		if wait < tc.min || wait > tc.max {
+			t.Errorf("[%d] Expected backoff between %s and %s but got %s", i, tc.min, tc.max, wait)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2021, time.March, 10, 14, 23, 45, 0, time.UTC)
+
+	testCases := []struct {
+		in  string
+		out time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"-5", 0},
+		{"Wed, 10 Mar 2021 14:24:15 GMT", 30 * time.Second},
+		{"Wed, 10 Mar 2021 14:20:00 GMT", 0},
+		{"soon", 0},
+	}
+
+	for _, tc := range testCases {
+		if out := parseRetryAfter(tc.in, now); out != tc.out {
+			t.Errorf("Expected %q to wait %s but got %s", tc.in, tc.out, out)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/geckoboard/sql-dataset/models"
+)
+
+// scheduledDataset tracks when a dataset is next due to be refreshed,
+// a nil schedule means the dataset only runs once on start up
+type scheduledDataset struct {
+	dataset  models.Dataset
+	spec     string
+	schedule models.Schedule
+	next     time.Time
+
+	// running is set while the dataset is being processed,
+	// it isn't due again until that run has finished
+	running bool
+}
+
+type scheduler struct {
+	datasets []*scheduledDataset
+	process  func(models.Dataset)
+	now      func() time.Time
+}
+
+// newScheduler builds the schedule for each dataset, datasets without their
+// own schedule fall back to running every refresh_time_sec when it is set
+func newScheduler(config *models.Config, process func(models.Dataset)) (*scheduler, error) {
+	s := &scheduler{process: process, now: time.Now}
+	start := s.now()
+
+	for _, ds := range config.Datasets {
+		sd := &scheduledDataset{dataset: ds, spec: ds.Schedule, next: start}
+
+		if sd.spec == "" && config.RefreshTimeSec > 0 {
+			sd.spec = fmt.Sprintf("@every %ds", config.RefreshTimeSec)
+		}
+
+		if sd.spec != "" {
+			sch, err := models.ParseSchedule(sd.spec)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid schedule for dataset %s: %s", ds.Name, err)
+			}
+
+			sd.schedule = sch
+		}
+
+		s.datasets = append(s.datasets, sd)
+	}
+
+	return s, nil
+}
+
+// Run processes every dataset straight away and then each time its schedule
+// is due. Each dataset is processed in its own goroutine so a slow dataset
+// doesn't hold up the others, and is only rescheduled once its run has
+// finished. Run returns once ctx is done or no
+// dataset has another run scheduled, after waiting for those in progress.
+func (s *scheduler) Run(ctx context.Context) {
+	for _, sd := range s.datasets {
+		if sd.schedule == nil {
+			logs.info(fmt.Sprintf("Running \"%s\" once", sd.dataset.Name),
+				fields{"dataset": sd.dataset.Name, "phase": "schedule"})
+		} else {
+			logs.info(fmt.Sprintf("Running \"%s\" on schedule \"%s\", until interrupted", sd.dataset.Name, sd.spec),
+				fields{"dataset": sd.dataset.Name, "phase": "schedule", "schedule": sd.spec})
+		}
+	}
+
+	logs.blank()
+
+	var (
+		wg       sync.WaitGroup
+		running  int
+		finished = make(chan *scheduledDataset)
+	)
+
+	defer wg.Wait()
+
+	for {
+		next := s.nextRun()
+		if next.IsZero() && running == 0 {
+			return
+		}
+
+		// Without a next run the timer never fires, so
+		// the loop waits for a running group to finish
+		timer := time.NewTimer(next.Sub(s.now()))
+		tick := timer.C
+
+		if next.IsZero() {
+			timer.Stop()
+			tick = nil
+		}
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case sd := <-finished:
+			timer.Stop()
+			running--
+
+			sd.running = false
+			sd.reschedule(s.now())
+			continue
+		case <-tick:
+		}
+
+		for _, sd := range s.due(s.now()) {
+			running++
+			wg.Add(1)
+
+			go func(sd *scheduledDataset) {
+				defer wg.Done()
+
+				s.process(sd.dataset)
+
+				select {
+				case finished <- sd:
+				case <-ctx.Done():
+				}
+			}(sd)
+		}
+	}
+}
+
+// due marks the datasets due to run at now as running and returns them
+func (s *scheduler) due(now time.Time) (due []*scheduledDataset) {
+	for _, sd := range s.datasets {
+		if sd.running || sd.next.IsZero() || sd.next.After(now) {
+			continue
+		}
+
+		sd.running = true
+		due = append(due, sd)
+	}
+
+	return due
+}
+
+// nextRun returns the earliest time any dataset is due,
+// or the zero time when nothing is left to run
+func (s *scheduler) nextRun() (next time.Time) {
+	for _, sd := range s.datasets {
+		if sd.running || sd.next.IsZero() {
+			continue
+		}
+
+		if next.IsZero() || sd.next.Before(next) {
+			next = sd.next
+		}
+	}
+
+	return next
+}
+
+func (sd *scheduledDataset) reschedule(from time.Time) {
+	if sd.schedule == nil {
+		sd.next = time.Time{}
+		return
+	}
+
+	sd.next = sd.schedule.Next(from)
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/geckoboard/sql-dataset/models"
+)
+
+func TestNewScheduler(t *testing.T) {
+	now := time.Date(2021, time.March, 10, 14, 23, 45, 0, time.UTC)
+
+	testCases := []struct {
+		config models.Config
+		next   map[string]time.Time
+		err    string
+	}{
+		{
+			// Without refresh time or schedules datasets only run once
+			config: models.Config{
+				Datasets: []models.Dataset{
+					{Name: "app.counts"},
+				},
+			},
+			next: map[string]time.Time{
+				"app.counts": {},
+			},
+		},
+		{
+			// Datasets without a schedule fall back to the refresh time
+			config: models.Config{
+				RefreshTimeSec: 60,
+				Datasets: []models.Dataset{
+					{Name: "app.counts"},
+					{Name: "app.revenue", Schedule: "0 2 1 * *"},
+					{Name: "app.builds", Schedule: "@every 10m"},
+				},
+			},
+			next: map[string]time.Time{
+				"app.counts":  now.Add(time.Minute),
+				"app.revenue": time.Date(2021, time.April, 1, 2, 0, 0, 0, time.UTC),
+				"app.builds":  now.Add(10 * time.Minute),
+			},
+		},
+		{
+			config: models.Config{
+				Datasets: []models.Dataset{
+					{Name: "app.counts", Schedule: "@every day"},
+				},
+			},
+			err: `Invalid schedule for dataset app.counts: time: invalid duration "day"`,
+		},
+	}
+
+	for i, tc := range testCases {
+		s, err := newScheduler(&tc.config, func(models.Dataset) {})
+
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("[%d] Expected error %s but got %v", i, tc.err, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("[%d] Expected no error but got %s", i, err)
+			continue
+		}
+
+		if len(s.datasets) != len(tc.next) {
+			t.Errorf("[%d] Expected %d scheduled datasets but got %d", i, len(tc.next), len(s.datasets))
+		}
+
+		for _, sd := range s.datasets {
+			sd.reschedule(now)
+
+			if exp := tc.next[sd.dataset.Name]; !sd.next.Equal(exp) {
+				t.Errorf("[%d] Expected %s next run at %s but got %s", i, sd.dataset.Name, exp, sd.next)
+			}
+		}
+	}
+}
+
+func TestSchedulerRunOnce(t *testing.T) {
+	config := models.Config{
+		Datasets: []models.Dataset{
+			{Name: "app.counts"},
+			{Name: "app.builds"},
+		},
+	}
+
+	var (
+		mu        sync.Mutex
+		processed []string
+	)
+
+	s, err := newScheduler(&config, func(ds models.Dataset) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		processed = append(processed, ds.Name)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.Run(context.Background())
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected scheduler to return once every dataset ran")
+	}
+
+	sort.Strings(processed)
+
+	if len(processed) != 2 || processed[0] != "app.builds" || processed[1] != "app.counts" {
+		t.Errorf("Expected both datasets to be processed once but got %v", processed)
+	}
+}
+
+func TestSchedulerRunStopsWhenCancelled(t *testing.T) {
+	config := models.Config{
+		Datasets: []models.Dataset{
+			{Name: "app.counts", Schedule: "@every 1h"},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runs := make(chan struct{}, 1)
+
+	s, err := newScheduler(&config, func(models.Dataset) {
+		runs <- struct{}{}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-runs:
+	case <-time.After(time.Second):
+		t.Fatal("Expected dataset to be processed on start up")
+	}
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected scheduler to return once cancelled")
+	}
+}
+
+// everySchedule is due at a fixed interval, unlike
+// parsed schedules it can be shorter than a second
+type everySchedule time.Duration
+
+func (e everySchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+func TestSchedulerSlowDatasetDoesntDelayOthers(t *testing.T) {
+	config := models.Config{
+		Datasets: []models.Dataset{
+			{Name: "app.rollup", Schedule: "@monthly"},
+			{Name: "app.orders", Schedule: "@every 1m"},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	release := make(chan struct{})
+	orders := make(chan struct{}, 10)
+
+	var (
+		mu      sync.Mutex
+		rollups int
+	)
+
+	s, err := newScheduler(&config, func(ds models.Dataset) {
+		if ds.Name == "app.orders" {
+			orders <- struct{}{}
+			return
+		}
+
+		mu.Lock()
+		rollups++
+		mu.Unlock()
+
+		// The rollup stays running until the test releases it
+		<-release
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.datasets[0].schedule = everySchedule(10 * time.Millisecond)
+	s.datasets[1].schedule = everySchedule(10 * time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-orders:
+		case <-time.After(time.Second):
+			t.Fatalf("Expected app.orders to run %d times while app.rollup was running", 3)
+		}
+	}
+
+	mu.Lock()
+	if rollups != 1 {
+		t.Errorf("Expected app.rollup to run once while still running but got %d runs", rollups)
+	}
+	mu.Unlock()
+
+	close(release)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected scheduler to return once cancelled")
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/geckoboard/sql-dataset/models"
+)
+
+// errRecreatedIncremental is returned when an incremental dataset is
+// recreated, as it must then be queried again from its cursor_initial_value
+var errRecreatedIncremental = errors.New("The dataset was recreated so its data must be sent again " +
+	"from the cursor_initial_value")
+
+// schemaConflictError is returned when a dataset already
+// exists in Geckoboard with a different schema to the config
+type schemaConflictError struct {
+	name string
+	diff []string
+}
+
+func (e *schemaConflictError) Error() string {
+	return fmt.Sprintf("The dataset %s already exists in Geckoboard with a different schema:\n%s\n"+
+		"Set recreate_on_schema_change to delete and recreate it, or delete it with -delete-dataset",
+		e.name, strings.Join(e.diff, "\n"))
+}
+
+// schemaDiff lists the differences between the dataset schema in the
+// config and in Geckoboard, fields only in the config are marked with
+// a +, those only in Geckoboard with a - and changed fields with a ~
+func schemaDiff(ds *models.Dataset, remote *remoteDataset) (diff []string) {
+	keys := make(map[string]bool)
+
+	for k := range ds.SchemaFields {
+		keys[k] = true
+	}
+
+	for k := range remote.Fields {
+		keys[k] = true
+	}
+
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+
+	sort.Strings(sorted)
+
+	for _, k := range sorted {
+		local, inConfig := ds.SchemaFields[k]
+		rf, inRemote := remote.Fields[k]
+
+		switch {
+		case !inRemote:
+			diff = append(diff, fmt.Sprintf("  + %s: %s", k, describeField(local)))
+		case !inConfig:
+			diff = append(diff, fmt.Sprintf("  - %s: %s", k, describeField(rf)))
+		case describeField(local) != describeField(rf):
+			diff = append(diff, fmt.Sprintf("  ~ %s: %s in Geckoboard, %s in the config",
+				k, describeField(rf), describeField(local)))
+		}
+	}
+
+	if strings.Join(ds.UniqueBy, ",") != strings.Join(remote.UniqueBy, ",") {
+		diff = append(diff, fmt.Sprintf("  ~ unique_by: [%s] in Geckoboard, [%s] in the config",
+			strings.Join(remote.UniqueBy, ", "), strings.Join(ds.UniqueBy, ", ")))
+	}
+
+	return diff
+}
+
+func describeField(f models.Field) string {
+	s := fmt.Sprintf("%s %q", f.Type, f.Name)
+
+	if f.CurrencyCode != "" {
+		s += " in " + f.CurrencyCode
+	}
+
+	if f.TimeUnit != "" {
+		s += " in " + f.TimeUnit
+	}
+
+	if f.Optional {
+		s += " (optional)"
+	}
+
+	return s
+}
+
+// findOrCreateDataset creates the dataset in Geckoboard, deleting and
+// recreating it first when its schema has changed and the config allows.
+// As an incremental dataset is only sent new rows, when recreated its last
+// value is cleared and errRecreatedIncremental returned so it's repopulated.
+func findOrCreateDataset(ctx context.Context, client *Client, ds *models.Dataset, st *state) error {
+	err := client.FindOrCreateDataset(ctx, ds)
+
+	var conflict *schemaConflictError
+	if !errors.As(err, &conflict) || !ds.AutoRecreate {
+		return err
+	}
+
+	logs.warn(fmt.Sprintf("Recreating \"%s\" as its schema has changed:\n%s", ds.Name, strings.Join(conflict.diff, "\n")),
+		fields{"dataset": ds.Name, "phase": "create", "diff": conflict.diff})
+
+	if err := client.DeleteDataset(ctx, ds.Name); err != nil {
+		return err
+	}
+
+	if err := client.FindOrCreateDataset(ctx, ds); err != nil {
+		return err
+	}
+
+	if ds.IsIncremental() && ds.LastValue != "" {
+		if err := st.setLastValue(ds.Name, ""); err != nil {
+			return err
+		}
+
+		return errRecreatedIncremental
+	}
+
+	return nil
+}
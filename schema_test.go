@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/geckoboard/sql-dataset/models"
+)
+
+func TestSchemaDiff(t *testing.T) {
+	ds := models.Dataset{
+		Name:     "app.builds",
+		UniqueBy: []string{"app"},
+		Fields: []models.Field{
+			{Name: "App", Type: models.StringType},
+			{Name: "Cost", Type: models.MoneyType, CurrencyCode: "USD"},
+			{Name: "Run time", Type: models.NumberType, Optional: true},
+		},
+	}
+
+	if err := ds.BuildSchemaFields(); err != nil {
+		t.Fatal(err)
+	}
+
+	remote := &remoteDataset{
+		ID: "app.builds",
+		Fields: map[string]models.Field{
+			"app":      {Name: "App", Type: models.StringType},
+			"cost":     {Name: "Cost", Type: models.MoneyType, CurrencyCode: "GBP"},
+			"passed":   {Name: "Passed", Type: models.PercentageType},
+			"run_time": {Name: "Run time", Type: models.NumberType, Optional: true},
+		},
+	}
+
+	exp := []string{
+		`  ~ cost: money "Cost" in GBP in Geckoboard, money "Cost" in USD in the config`,
+		`  - passed: percentage "Passed"`,
+		`  ~ unique_by: [] in Geckoboard, [app] in the config`,
+	}
+
+	if diff := schemaDiff(&ds, remote); !reflect.DeepEqual(diff, exp) {
+		t.Errorf("Expected diff\n%s\nbut got\n%s", strings.Join(exp, "\n"), strings.Join(diff, "\n"))
+	}
+
+	remote.Fields = ds.SchemaFields
+	remote.UniqueBy = []string{"app"}
+
+	if diff := schemaDiff(&ds, remote); diff != nil {
+		t.Errorf("Expected no diff but got %v", diff)
+	}
+}
+
+func TestFindOrCreateDatasetSchemaChange(t *testing.T) {
+	testCases := []struct {
+		recreate  bool
+		lastValue string
+		requests  []string
+		err       string
+	}{
+		{
+			requests: []string{"PUT", "GET"},
+			err: "The dataset app.builds already exists in Geckoboard with a different schema:\n" +
+				`  + app: string "App"` + "\n" +
+				`  - name: string "Name"` + "\n" +
+				"Set recreate_on_schema_change to delete and recreate it, or delete it with -delete-dataset",
+		},
+		{
+			recreate: true,
+			requests: []string{"PUT", "GET", "DELETE", "PUT"},
+		},
+		{
+			recreate:  true,
+			lastValue: "12",
+			requests:  []string{"PUT", "GET", "DELETE", "PUT"},
+			err:       errRecreatedIncremental.Error(),
+		},
+	}
+
+	for i, tc := range testCases {
+		var requests []string
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r.Method)
+
+			switch {
+			case r.Method == http.MethodPut && len(requests) == 1:
+				w.WriteHeader(http.StatusConflict)
+				fmt.Fprintf(w, `{"error":{"message":"Fields don't match"}}`)
+			case r.Method == http.MethodGet:
+				fmt.Fprintf(w, `{"id":"app.builds","fields":{"name":{"type":"string","name":"Name"}}}`)
+			default:
+				fmt.Fprintf(w, `{}`)
+			}
+		}))
+
+		gbHost = server.URL
+
+		ds := models.Dataset{
+			Name:         "app.builds",
+			UpdateType:   models.Append,
+			AutoRecreate: tc.recreate,
+			LastValue:    tc.lastValue,
+			Fields:       []models.Field{{Name: "App", Type: models.StringType}},
+		}
+
+		if tc.lastValue != "" {
+			ds.CursorColumn = "app"
+		}
+
+		st := &state{Datasets: map[string]*datasetState{"app.builds": {LastValue: tc.lastValue}}, readOnly: true}
+		err := findOrCreateDataset(context.Background(), NewClient(apiKey), &ds, st)
+
+		switch {
+		case err == nil && tc.err != "":
+			t.Errorf("[%d] Expected error %q but got none", i, tc.err)
+		case err != nil && err.Error() != tc.err:
+			t.Errorf("[%d] Expected error %q but got %q", i, tc.err, err)
+		}
+
+		if !reflect.DeepEqual(requests, tc.requests) {
+			t.Errorf("[%d] Expected requests %v but got %v", i, tc.requests, requests)
+		}
+
+		if v := st.lastValue("app.builds"); tc.err != "" && tc.recreate && v != "" {
+			t.Errorf("[%d] Expected the last value to be cleared but got %q", i, v)
+		}
+
+		server.Close()
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/geckoboard/sql-dataset/models"
+)
+
+const defaultStateFile = "sql-dataset-state.json"
+
+// state is kept in a local JSON file between runs, holding the outcome
+// of the last run of each dataset and the last value sent for incremental
+// datasets
+type state struct {
+	mu       sync.Mutex
+	path     string
+	readOnly bool
+	Datasets map[string]*datasetState `json:"datasets"`
+}
+
+type datasetState struct {
+	LastValue   string    `json:"last_value,omitempty"`
+	LastRun     time.Time `json:"last_run"`
+	LastPushed  time.Time `json:"last_pushed"`
+	DurationMS  int64     `json:"duration_ms"`
+	Rows        int       `json:"rows"`
+	Deleted     int       `json:"deleted,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	PayloadHash string    `json:"payload_hash,omitempty"`
+	Unchanged   bool      `json:"unchanged,omitempty"`
+}
+
+// loadState reads the state file for the config,
+// a missing file is treated as an empty state
+func loadState(config *models.Config) (*state, error) {
+	s := &state{
+		path:     config.StateFile,
+		Datasets: make(map[string]*datasetState),
+	}
+
+	if s.path == "" {
+		s.path = defaultStateFile
+	}
+
+	b, err := ioutil.ReadFile(s.path)
+
+	switch {
+	case os.IsNotExist(err):
+		return s, nil
+	case err != nil:
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, err
+	}
+
+	if s.Datasets == nil {
+		s.Datasets = make(map[string]*datasetState)
+	}
+
+	return s, nil
+}
+
+// lastValue returns the last value sent for the dataset
+func (s *state) lastValue(name string) string {
+	if s == nil {
+		return ""
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ds := s.Datasets[name]; ds != nil {
+		return ds.LastValue
+	}
+
+	return ""
+}
+
+// setLastValue records the last value sent for the dataset and saves the state
+func (s *state) setLastValue(name, v string) error {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Datasets[name] == nil {
+		s.Datasets[name] = &datasetState{}
+	}
+
+	s.Datasets[name].LastValue = v
+
+	if s.readOnly {
+		return nil
+	}
+
+	return s.save()
+}
+
+// forget clears the payload hash and last value of a dataset deleted from
+// Geckoboard, so the next update recreates it and sends all of its data
+func (s *state) forget(name string) error {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ds := s.Datasets[name]
+	if ds == nil {
+		return nil
+	}
+
+	ds.PayloadHash = ""
+	ds.LastValue = ""
+
+	if s.readOnly {
+		return nil
+	}
+
+	return s.save()
+}
+
+// unchanged reports whether the payload is the same as the last successful
+// update of the dataset, so sending it can be skipped. Once the max interval
+// has passed since the data was last sent it's always sent again.
+func (s *state) unchanged(sc *models.SkipUnchangedConfig, name, hash string, now time.Time) bool {
+	if s == nil || sc == nil {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ds := s.Datasets[name]
+
+	if ds == nil || ds.Error != "" || ds.PayloadHash != hash || ds.LastPushed.IsZero() {
+		return false
+	}
+
+	return sc.MaxInterval == 0 || now.Sub(ds.LastPushed) < sc.MaxInterval
+}
+
+// recordRun records the outcome of a dataset run and saves the state,
+// datasets which were skipped never ran so aren't recorded
+func (s *state) recordRun(r datasetResult) error {
+	if s == nil || r.err == errSkippedShutdown {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ds := s.Datasets[r.name]
+	if ds == nil {
+		ds = &datasetState{}
+		s.Datasets[r.name] = ds
+	}
+
+	ds.LastRun = r.started
+	ds.DurationMS = r.duration.Milliseconds()
+	ds.Rows = r.rows
+	ds.Deleted = r.deleted
+	ds.PayloadHash = r.hash
+	ds.Unchanged = r.unchanged
+	ds.Error = ""
+
+	if r.err != nil {
+		ds.Error = r.err.Error()
+	}
+
+	if r.err == nil && !r.unchanged {
+		ds.LastPushed = r.started
+	}
+
+	if s.readOnly {
+		return nil
+	}
+
+	return s.save()
+}
+
+// save writes the state to a temporary file which replaces the
+// state file, so it's never left half written. The lock must be held.
+func (s *state) save() error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), s.path)
+}
+
+// hashSchema adds the fields and unique_by the dataset is created with to the
+// hash of a payload, so a change to either is sent even if the rows aren't
+func hashSchema(h hash.Hash, ds *models.Dataset) error {
+	if err := ds.BuildSchemaFields(); err != nil {
+		return err
+	}
+
+	return json.NewEncoder(h).Encode(struct {
+		Fields   map[string]models.Field `json:"fields"`
+		UniqueBy []string                `json:"unique_by"`
+	}{ds.SchemaFields, ds.UniqueBy})
+}
+
+// hashRows adds the rows to the hash of a payload,
+// as maps are encoded with sorted keys the hash is stable
+func hashRows(h hash.Hash, rows models.DatasetRows) error {
+	enc := json.NewEncoder(h)
+
+	for _, row := range rows {
+		if err := enc.Encode(row); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/geckoboard/sql-dataset/models"
+)
+
+func TestState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sql-dataset")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	config := models.Config{StateFile: filepath.Join(dir, "state.json")}
+
+	st, err := loadState(&config)
+	if err != nil {
+		t.Fatalf("Expected a missing state file to load but got %s", err)
+	}
+
+	// A read only state isn't saved
+	st.readOnly = true
+
+	if err := st.setLastValue("app.builds", "12"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(config.StateFile); !os.IsNotExist(err) {
+		t.Errorf("Expected no state file to be written but got %v", err)
+	}
+
+	st.readOnly = false
+
+	if err := st.setLastValue("app.builds", "13"); err != nil {
+		t.Fatal(err)
+	}
+
+	if st, err = loadState(&config); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := st.lastValue("app.builds"); v != "13" {
+		t.Errorf("Expected last value 13 but got %q", v)
+	}
+
+	if v := st.lastValue("app.other"); v != "" {
+		t.Errorf("Expected no last value but got %q", v)
+	}
+
+	var nilState *state
+	if v := nilState.lastValue("app.builds"); v != "" || nilState.setLastValue("app.builds", "1") != nil {
+		t.Error("Expected a nil state to be usable")
+	}
+
+	if err := ioutil.WriteFile(config.StateFile, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loadState(&config); err == nil {
+		t.Error("Expected an invalid state file to error")
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/geckoboard/sql-dataset/models"
+)
+
+const statusTimeFormat = "2006-01-02 15:04:05"
+
+// printStatus writes a table of the last run of each dataset in the config
+// from the state file, followed by any datasets only in the state file
+func printStatus(w io.Writer, config *models.Config, st *state) {
+	names := make([]string, 0, len(config.Datasets))
+	seen := make(map[string]bool)
+
+	for _, ds := range config.Datasets {
+		names = append(names, ds.Name)
+		seen[ds.Name] = true
+	}
+
+	var others []string
+	for name := range st.Datasets {
+		if !seen[name] {
+			others = append(others, name)
+		}
+	}
+
+	sort.Strings(others)
+	names = append(names, others...)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DATASET\tLAST RUN\tDURATION\tROWS\tPAYLOAD\tSTATUS")
+
+	for _, name := range names {
+		ds := st.Datasets[name]
+
+		if ds == nil || ds.LastRun.IsZero() {
+			fmt.Fprintf(tw, "%s\t-\t-\t-\t-\tNever run\n", name)
+			continue
+		}
+
+		status := "OK"
+
+		switch {
+		case ds.Error != "":
+			status = "Failed: " + ds.Error
+		case ds.Unchanged:
+			status = "OK, unchanged so not sent"
+		}
+
+		if !seen[name] {
+			status += " (not in config)"
+		}
+
+		hash := "-"
+		if len(ds.PayloadHash) >= 12 {
+			hash = ds.PayloadHash[:12]
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\n",
+			name,
+			ds.LastRun.Local().Format(statusTimeFormat),
+			time.Duration(ds.DurationMS)*time.Millisecond,
+			ds.Rows,
+			hash,
+			status,
+		)
+	}
+
+	tw.Flush()
+}
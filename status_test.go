@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/geckoboard/sql-dataset/models"
+)
+
+func TestPrintStatus(t *testing.T) {
+	config := models.Config{
+		Datasets: []models.Dataset{
+			{Name: "app.builds"},
+			{Name: "app.costs"},
+			{Name: "app.new"},
+		},
+	}
+
+	st := &state{Datasets: make(map[string]*datasetState), readOnly: true}
+	started := time.Date(2021, time.March, 10, 14, 23, 45, 0, time.Local)
+
+	results := []datasetResult{
+		{name: "app.builds", rows: 120, started: started, duration: 1520 * time.Millisecond, hash: "8f434346648f6b96df89dda901c5176b10a6d83961dd3c1ac88b59b2dc327aa4"},
+		{name: "app.costs", started: started, duration: 30 * time.Second, err: errors.New("Query failed")},
+		{name: "app.removed", rows: 3, started: started, duration: time.Millisecond, hash: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{name: "app.new", err: errSkippedShutdown},
+	}
+
+	for _, r := range results {
+		if err := st.recordRun(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	printStatus(&buf, &config, st)
+
+	exp := `DATASET      LAST RUN             DURATION  ROWS  PAYLOAD       STATUS
+app.builds   2021-03-10 14:23:45  1.52s     120   8f434346648f  OK
+app.costs    2021-03-10 14:23:45  30s       0     -             Failed: Query failed
+app.new      -                    -         -     -             Never run
+app.removed  2021-03-10 14:23:45  1ms       3     e3b0c44298fc  OK (not in config)
+`
+
+	if buf.String() != exp {
+		t.Errorf("Expected status\n%s\nbut got\n%s", exp, buf.String())
+	}
+}
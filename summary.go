@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/geckoboard/sql-dataset/models"
+)
+
+// The exit codes of a run, so scripts can tell what kind of failure
+// stopped datasets updating. exitUsage is the code the flag package
+// exits with when it can't parse the flags.
+const (
+	exitOK         = 0
+	exitFailure    = 1
+	exitUsage      = 2
+	exitConfig     = 3
+	exitConnection = 4
+	exitQuery      = 5
+	exitAPI        = 6
+)
+
+// failureKind is the stage of a dataset update which failed
+type failureKind int
+
+const (
+	failedOther failureKind = iota
+	failedConfig
+	failedConnection
+	failedQuery
+	failedAPI
+)
+
+func (k failureKind) exitCode() int {
+	switch k {
+	case failedConfig:
+		return exitConfig
+	case failedConnection:
+		return exitConnection
+	case failedQuery:
+		return exitQuery
+	case failedAPI:
+		return exitAPI
+	}
+
+	return exitFailure
+}
+
+func (k failureKind) String() string {
+	switch k {
+	case failedConfig:
+		return "Config error"
+	case failedConnection:
+		return "Database connection error"
+	case failedQuery:
+		return "Query error"
+	case failedAPI:
+		return "Geckoboard API error"
+	}
+
+	return "Error"
+}
+
+// phase names the stage in logged events
+func (k failureKind) phase() string {
+	switch k {
+	case failedConfig:
+		return "config"
+	case failedConnection:
+		return "connect"
+	case failedQuery:
+		return "query"
+	case failedAPI:
+		return "send"
+	}
+
+	return "update"
+}
+
+// queryFailure is the kind of failure for an error querying the database,
+// telling a lost or refused connection apart from the query failing
+func queryFailure(err error) failureKind {
+	var connErr *models.ConnectionError
+	if errors.As(err, &connErr) {
+		return failedConnection
+	}
+
+	return failedQuery
+}
+
+// configError is an error caused by the config rather than
+// the database it names, such as a dataset it doesn't have
+type configError struct {
+	err error
+}
+
+func (e *configError) Error() string {
+	return e.err.Error()
+}
+
+func (e *configError) Unwrap() error {
+	return e.err
+}
+
+// errorExitCode is the exit code for a command which failed with err
+func errorExitCode(err error) int {
+	var cfgErr *configError
+
+	switch {
+	case queryFailure(err) == failedConnection:
+		return exitConnection
+	case errors.As(err, &cfgErr):
+		return exitConfig
+	}
+
+	return exitFailure
+}
+
+// fail records the error and the stage of the update it came from
+func (r *datasetResult) fail(kind failureKind, err error) {
+	r.kind = kind
+	r.err = err
+}
+
+// resultsExitCode returns the exit code for the results of a run. When every
+// failed dataset failed at the same stage its code is used, otherwise failures
+// of different kinds are reported with the general exit code.
+func resultsExitCode(results []datasetResult) int {
+	code := exitOK
+
+	for _, r := range results {
+		if r.err == nil {
+			continue
+		}
+
+		c := exitFailure
+		if r.err != errSkippedShutdown {
+			c = r.kind.exitCode()
+		}
+
+		if code != exitOK && code != c {
+			return exitFailure
+		}
+
+		code = c
+	}
+
+	return code
+}
+
+// logResults writes a table of the results in the text log
+// format, or logs an event for each dataset as JSON
+func logResults(results []datasetResult) {
+	if !logs.json {
+		logs.blank()
+		logs.mu.Lock()
+		defer logs.mu.Unlock()
+
+		printResultsTable(logs.w, results)
+		return
+	}
+
+	for _, r := range results {
+		f := fields{
+			"dataset":     r.name,
+			"phase":       "summary",
+			"rows":        r.rows,
+			"duration_ms": r.duration.Milliseconds(),
+			"status":      resultStatus(r),
+		}
+
+		if r.err != nil {
+			f["error"] = r.err
+		}
+
+		logs.info(fmt.Sprintf("%s: %s", r.name, resultStatus(r)), f)
+	}
+}
+
+// printResultsTable writes a table of the outcome of each dataset update
+func printResultsTable(w io.Writer, results []datasetResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DATASET\tROWS\tDURATION\tSTATUS")
+
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", r.name, r.rows, r.duration.Round(time.Millisecond), resultStatus(r))
+	}
+
+	tw.Flush()
+}
+
+func resultStatus(r datasetResult) string {
+	switch {
+	case r.err == errSkippedShutdown:
+		return "Skipped"
+	case r.err != nil:
+		return "Failed: " + r.kind.String()
+	case r.unchanged:
+		return "OK, unchanged so not sent"
+	}
+
+	return "OK"
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/geckoboard/sql-dataset/models"
+)
+
+func TestResultsExitCode(t *testing.T) {
+	failed := errors.New("failed")
+
+	testCases := []struct {
+		results []datasetResult
+		code    int
+	}{
+		{
+			results: []datasetResult{{name: "a"}, {name: "b", unchanged: true}},
+			code:    exitOK,
+		},
+		{
+			results: []datasetResult{{name: "a"}, {name: "b", err: failed, kind: failedQuery}},
+			code:    exitQuery,
+		},
+		{
+			results: []datasetResult{{name: "a", err: failed, kind: failedAPI}, {name: "b", err: failed, kind: failedAPI}},
+			code:    exitAPI,
+		},
+		{
+			results: []datasetResult{{name: "a", err: failed, kind: failedConfig}},
+			code:    exitConfig,
+		},
+		{
+			results: []datasetResult{{name: "a", err: failed, kind: failedConnection}},
+			code:    exitConnection,
+		},
+		{
+			// Failures of different kinds use the general code
+			results: []datasetResult{{name: "a", err: failed, kind: failedQuery}, {name: "b", err: failed, kind: failedAPI}},
+			code:    exitFailure,
+		},
+		{
+			results: []datasetResult{{name: "a", err: failed, kind: failedOther}},
+			code:    exitFailure,
+		},
+		{
+			results: []datasetResult{{name: "a", err: errSkippedShutdown}},
+			code:    exitFailure,
+		},
+	}
+
+	for i, tc := range testCases {
+		if code := resultsExitCode(tc.results); code != tc.code {
+			t.Errorf("[%d] Expected exit code %d but got %d", i, tc.code, code)
+		}
+	}
+}
+
+func TestQueryFailure(t *testing.T) {
+	connErr := &models.ConnectionError{Err: errors.New("connection refused")}
+
+	testCases := []struct {
+		err  error
+		kind failureKind
+		code int
+	}{
+		{
+			err:  connErr,
+			kind: failedConnection,
+			code: exitConnection,
+		},
+		{
+			err:  fmt.Errorf("Failed to preview: %w", connErr),
+			kind: failedConnection,
+			code: exitConnection,
+		},
+		{
+			err:  errors.New("Query failed"),
+			kind: failedQuery,
+			code: exitFailure,
+		},
+		{
+			err:  fmt.Errorf("Database %q: %w", "warehouse", &configError{errors.New("No username provided")}),
+			kind: failedQuery,
+			code: exitConfig,
+		},
+	}
+
+	for i, tc := range testCases {
+		if kind := queryFailure(tc.err); kind != tc.kind {
+			t.Errorf("[%d] Expected failure %s but got %s", i, tc.kind, kind)
+		}
+
+		if code := errorExitCode(tc.err); code != tc.code {
+			t.Errorf("[%d] Expected exit code %d but got %d", i, tc.code, code)
+		}
+	}
+}
+
+func TestOpenDatabaseErrorExitCodes(t *testing.T) {
+	config := &models.Config{
+		DatabaseConfig: &models.DatabaseConfig{Driver: models.PostgresDriver, Host: "127.0.0.1", Port: "9999", Database: "db"},
+		Datasets:       []models.Dataset{{Name: "app.builds"}},
+	}
+
+	// Without a username the connection string can't be built
+	if _, err := openDatabases(config); errorExitCode(err) != exitConfig {
+		t.Errorf("Expected a config error but got %v", err)
+	}
+
+	if _, _, _, err := openDatasetDatabase("app.missing", config); errorExitCode(err) != exitConfig {
+		t.Errorf("Expected a config error but got %v", err)
+	}
+
+	// Nothing listens on the port so the connection is refused
+	config.DatabaseConfig.Username = "user"
+	config.DatabaseConfig.TLSConfig = &models.TLSConfig{SSLMode: "disable"}
+
+	if _, err := openDatabases(config); errorExitCode(err) != exitConnection {
+		t.Errorf("Expected a connection error but got %v", err)
+	}
+}
+
+func TestPrintResultsTable(t *testing.T) {
+	results := []datasetResult{
+		{name: "app.builds", rows: 120, duration: 1520400 * time.Microsecond},
+		{name: "app.costs", rows: 3, duration: 20 * time.Millisecond, unchanged: true},
+		{name: "app.failing", duration: 2 * time.Second, err: errors.New("Query failed"), kind: failedQuery},
+		{name: "app.new", err: errSkippedShutdown},
+	}
+
+	var buf bytes.Buffer
+	printResultsTable(&buf, results)
+
+	exp := `DATASET      ROWS  DURATION  STATUS
+app.builds   120   1.52s     OK
+app.costs    3     20ms      OK, unchanged so not sent
+app.failing  0     2s        Failed: Query error
+app.new      0     0s        Skipped
+`
+
+	if buf.String() != exp {
+		t.Errorf("Expected results\n%s\nbut got\n%s", exp, buf.String())
+	}
+}
+
+func TestProcessAllDatasetsExitCodes(t *testing.T) {
+	maxRows = originalBatchRows
+
+	gbWS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":{"message":"Bad request"}}`)
+	}))
+	defer gbWS.Close()
+
+	gbHost = gbWS.URL
+
+	db, err := newDBConnection(models.SQLiteDriver, filepath.Join("models", "fixtures", "db.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dsFields := []models.Field{{Name: "App", Type: models.StringType}}
+
+	testCases := []struct {
+		sql  string
+		code int
+	}{
+		{
+			sql:  "SELECT app_name FROM missing_table",
+			code: exitQuery,
+		},
+		{
+			sql:  "SELECT app_name FROM builds",
+			code: exitAPI,
+		},
+	}
+
+	for i, tc := range testCases {
+		config := models.Config{
+			DatabaseConfig: &models.DatabaseConfig{Driver: models.SQLiteDriver},
+			Datasets: []models.Dataset{
+				{Name: "app.builds", SQL: tc.sql, UpdateType: models.Replace, Fields: dsFields},
+			},
+		}
+
+		if code := processAllDatasets(&config, clients{"": NewClient("fakeKey")}, databases{"": db}, nil); code != tc.code {
+			t.Errorf("[%d] Expected exit code %d but got %d", i, tc.code, code)
+		}
+	}
+}